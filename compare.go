@@ -0,0 +1,360 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The kinds of Diff reported by Receipt.Compare.
+const (
+	DiffStatus        = "status"
+	DiffMimeType      = "mimeType"
+	DiffHeaderMissing = "header.missing"
+	DiffHeaderChanged = "header.changed"
+	DiffBody          = "body"
+	DiffBodyMissing   = "body.missing"
+	DiffBodyAdded     = "body.added"
+	DiffBodyChanged   = "body.changed"
+)
+
+// DefaultIgnoredHeaders are the response headers not compared by Receipt.Compare
+// since they change with every response.
+var DefaultIgnoredHeaders = []string{
+	"Date", "Set-Cookie", "Age", "Expires", "Last-Modified", "Etag",
+	"Content-Length", "Connection", "Keep-Alive", "Transfer-Encoding",
+}
+
+// Diff is a difference between the recorded and the replayed response.
+type Diff struct {
+	// Kind of the difference, e.g. DiffStatus.
+	Kind string `json:"kind"`
+	// Path is the header name of header differences, or the path of the value
+	// in the JSON body, like $.data.items[0], for body differences.
+	Path string `json:"path,omitempty"`
+	// Recorded value, JSON encoded for body differences.
+	Want string `json:"want,omitempty"`
+	// Replayed value, JSON encoded for body differences.
+	Got string `json:"got,omitempty"`
+}
+
+func (d Diff) String() string {
+	if d.Path == "" {
+		return fmt.Sprintf("%s: want %q, got %q", d.Kind, d.Want, d.Got)
+	}
+	return fmt.Sprintf("%s %s: want %q, got %q", d.Kind, d.Path, d.Want, d.Got)
+}
+
+// Report lists the differences between the recorded response of an entry and
+// its replayed response.
+type Report struct {
+	EntryID string `json:"entryId"`
+	Method  string `json:"method"`
+	URL     string `json:"url"`
+	Diffs   []Diff `json:"diffs"`
+}
+
+// OK reports whether the replayed response matches the recorded one.
+func (r *Report) OK() bool {
+	return len(r.Diffs) == 0
+}
+
+// CompareOption configures Receipt.Compare.
+type CompareOption func(c *comparer)
+
+type comparer struct {
+	ignoreHeaders map[string]bool
+	ignorePaths   [][]string
+	text          bool
+	diffs         []Diff
+}
+
+// WithIgnoreHeaders ignores the given response headers in addition to
+// DefaultIgnoredHeaders.
+func WithIgnoreHeaders(names ...string) CompareOption {
+	return func(c *comparer) {
+		for _, n := range names {
+			c.ignoreHeaders[textproto.CanonicalMIMEHeaderKey(n)] = true
+		}
+	}
+}
+
+// WithIgnoreJSONPaths ignores the values at the given paths of JSON bodies,
+// and everything below them. Paths are written as for ExtractJSON, a * segment
+// matches any field or index, e.g. $.items[*].updatedAt. It panics if a path
+// is invalid, as regexp.MustCompile does.
+func WithIgnoreJSONPaths(paths ...string) CompareOption {
+	var ignored = make([][]string, 0, len(paths))
+	for _, p := range paths {
+		keys, err := parseJSONPath(p)
+		if err != nil {
+			panic(err)
+		}
+		ignored = append(ignored, keys)
+	}
+	return func(c *comparer) {
+		c.ignorePaths = append(c.ignorePaths, ignored...)
+	}
+}
+
+// WithCompareText whether bodies that are not JSON are compared byte for byte,
+// they are not compared by default.
+func WithCompareText(enabled bool) CompareOption {
+	return func(c *comparer) {
+		c.text = enabled
+	}
+}
+
+// Compare reports the differences between the recorded response of the entry
+// and the replayed response: the status, the mime type, the recorded headers
+// missing or changed, and the body decoded as by DecodedBody, a body that
+// cannot be decoded is reported as a DiffBody. JSON bodies are compared
+// structurally, the order of object fields does not matter. The body is not
+// compared if it was not recorded or not entirely captured, see WithMaxBodyCapture.
+// Compare must be called before FillInResponse replaces the recorded response.
+func (r *Receipt) Compare(opts ...CompareOption) *Report {
+	var report = &Report{}
+	if r.Entry != nil && r.Entry.Request != nil {
+		report.EntryID = r.Entry.ID
+		report.Method = r.Entry.Request.Method
+		report.URL = r.Entry.Request.URL
+	}
+	if r.Entry == nil || r.Entry.Response == nil || r.Response == nil {
+		return report
+	}
+
+	var c = &comparer{ignoreHeaders: make(map[string]bool)}
+	WithIgnoreHeaders(DefaultIgnoredHeaders...)(c)
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	var want = r.Entry.Response
+	if want.Status != r.Response.StatusCode {
+		c.add(Diff{Kind: DiffStatus, Want: strconv.Itoa(want.Status), Got: strconv.Itoa(r.Response.StatusCode)})
+	}
+
+	var wantMime, gotMime string
+	if want.Content != nil {
+		wantMime = want.Content.MimeType
+	}
+	gotMime = r.Response.Header.Get("Content-Type")
+	if mediaType(wantMime) != mediaType(gotMime) {
+		c.add(Diff{Kind: DiffMimeType, Want: wantMime, Got: gotMime})
+	}
+
+	c.headers(want.Headers, r.Response.Header)
+
+	if want.Content != nil && len(want.Content.Text) > 0 && r.body != nil && r.body.complete() {
+		// the recorded text is decoded, so is the replayed body
+		got, err := r.DecodedBody()
+		if err != nil {
+			c.add(Diff{Kind: DiffBody, Want: string(want.Content.Text), Got: err.Error()})
+		} else {
+			c.body(mediaType(gotMime), want.Content.Text, got)
+		}
+	}
+	report.Diffs = c.diffs
+	return report
+}
+
+func (c *comparer) add(d Diff) {
+	c.diffs = append(c.diffs, d)
+}
+
+// mediaType returns the media type of a Content-Type without its parameters.
+func mediaType(ct string) string {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(ct))
+	}
+	return mt
+}
+
+func (c *comparer) headers(recorded []*NVP, got http.Header) {
+	var (
+		want  = make(http.Header)
+		names []string
+	)
+	for _, h := range recorded {
+		// HTTP/2 pseudo-headers such as :status
+		if strings.HasPrefix(h.Name, ":") {
+			continue
+		}
+		var name = textproto.CanonicalMIMEHeaderKey(h.Name)
+		// the content type is compared as the mime type
+		if c.ignoreHeaders[name] || name == "Content-Type" {
+			continue
+		}
+		if _, ok := want[name]; !ok {
+			names = append(names, name)
+		}
+		want[name] = append(want[name], h.Value)
+	}
+	for _, name := range names {
+		var (
+			w = strings.Join(want[name], ", ")
+			g = strings.Join(got.Values(name), ", ")
+		)
+		switch {
+		case len(got.Values(name)) == 0:
+			c.add(Diff{Kind: DiffHeaderMissing, Path: name, Want: w})
+		case w != g:
+			c.add(Diff{Kind: DiffHeaderChanged, Path: name, Want: w, Got: g})
+		}
+	}
+}
+
+func (c *comparer) body(mt string, want, got []byte) {
+	var wv, gv any
+	if isJSON(mt) && json.Unmarshal(want, &wv) == nil && json.Unmarshal(got, &gv) == nil {
+		c.json(nil, wv, gv)
+		return
+	}
+	if c.text && !bytes.Equal(want, got) {
+		c.add(Diff{Kind: DiffBody, Want: string(want), Got: string(got)})
+	}
+}
+
+// isJSON reports whether mt is application/json or a +json media type.
+func isJSON(mt string) bool {
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// json compares the JSON values at path.
+func (c *comparer) json(path []string, want, got any) {
+	if c.ignored(path) {
+		return
+	}
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			break
+		}
+		var keys = make([]string, 0, len(w)+len(g))
+		for k := range w {
+			keys = append(keys, k)
+		}
+		for k := range g {
+			if _, ok := w[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			c.jsonField(append(slices.Clip(path), k), w, g, k)
+		}
+		return
+	case []any:
+		g, ok := got.([]any)
+		if !ok {
+			break
+		}
+		for i := range max(len(w), len(g)) {
+			var p = append(slices.Clip(path), strconv.Itoa(i))
+			switch {
+			case i >= len(g):
+				if !c.ignored(p) {
+					c.add(Diff{Kind: DiffBodyMissing, Path: jsonPath(p), Want: jsonString(w[i])})
+				}
+			case i >= len(w):
+				if !c.ignored(p) {
+					c.add(Diff{Kind: DiffBodyAdded, Path: jsonPath(p), Got: jsonString(g[i])})
+				}
+			default:
+				c.json(p, w[i], g[i])
+			}
+		}
+		return
+	}
+	if !jsonEqual(want, got) {
+		c.add(Diff{Kind: DiffBodyChanged, Path: jsonPath(path), Want: jsonString(want), Got: jsonString(got)})
+	}
+}
+
+func (c *comparer) jsonField(path []string, want, got map[string]any, k string) {
+	wv, inWant := want[k]
+	gv, inGot := got[k]
+	switch {
+	case c.ignored(path):
+	case !inGot:
+		c.add(Diff{Kind: DiffBodyMissing, Path: jsonPath(path), Want: jsonString(wv)})
+	case !inWant:
+		c.add(Diff{Kind: DiffBodyAdded, Path: jsonPath(path), Got: jsonString(gv)})
+	default:
+		c.json(path, wv, gv)
+	}
+}
+
+// ignored reports whether path is below one of the ignored paths.
+func (c *comparer) ignored(path []string) bool {
+	for _, ignore := range c.ignorePaths {
+		if len(ignore) > len(path) {
+			continue
+		}
+		var match = true
+		for i, k := range ignore {
+			if k != "*" && k != path[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonEqual(a, b any) bool {
+	return jsonString(a) == jsonString(b)
+}
+
+func jsonString(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// jsonPath formats the keys of a JSON value like the paths of ExtractJSON.
+func jsonPath(keys []string) string {
+	var sb strings.Builder
+	sb.WriteString("$")
+	for _, k := range keys {
+		if _, err := strconv.Atoi(k); err == nil {
+			sb.WriteString("[" + k + "]")
+		} else {
+			sb.WriteString("." + k)
+		}
+	}
+	return sb.String()
+}
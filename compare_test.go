@@ -0,0 +1,154 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReceiptCompare(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("X-Version", "2")
+		_, _ = io.WriteString(w, `{"id":1,"name":"go-har","tags":["a","c"],"updatedAt":"now","extra":true,"items":[{"at":2}]}`)
+	}))
+	defer srv.Close()
+
+	har := newReplayHar(srv.URL, []string{"/"}, []time.Duration{0})
+	har.Log.Entries[0].Response = &Response{
+		Status: http.StatusCreated,
+		Headers: []*NVP{
+			{Name: "content-type", Value: "application/json"},
+			{Name: "x-version", Value: "1"},
+			{Name: "x-request-id", Value: "abc"},
+			{Name: "date", Value: "Mon, 01 Jan 2024 00:00:00 GMT"},
+		},
+		Content: &Content{
+			MimeType: "application/json",
+			Text:     []byte(`{"name":"go-har","id":1,"tags":["a","b","d"],"updatedAt":"then","items":[{"at":1}]}`),
+		},
+	}
+	h, err := NewHandler(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipts, err := h.Execute(context.TODO())
+	if err != nil {
+		t.Fatalf("Execute: %s", err)
+	}
+	report := receipts[0].Compare(WithIgnoreHeaders("x-request-id"), WithIgnoreJSONPaths("$.updatedAt", "$.items[*].at"))
+	if report.OK() || report.EntryID != har.Log.Entries[0].ID || report.URL != srv.URL+"/" {
+		t.Fatalf("report: %+v", report)
+	}
+
+	var got []string
+	for _, d := range report.Diffs {
+		got = append(got, d.String())
+	}
+	want := []string{
+		`status: want "201", got "200"`,
+		`header.changed X-Version: want "1", got "2"`,
+		`body.added $.extra: want "", got "true"`,
+		`body.changed $.tags[1]: want "\"b\"", got "\"c\""`,
+		`body.missing $.tags[2]: want "\"d\"", got ""`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diffs:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	har.Log.Entries[0].Response.Content.MimeType = "text/html"
+	har.Log.Entries[0].Response.Content.Text = []byte("<html></html>")
+	har.Log.Entries[0].Response.Headers = nil
+	report = receipts[0].Compare(WithCompareText(true))
+	var kinds []string
+	for _, d := range report.Diffs {
+		kinds = append(kinds, d.Kind)
+	}
+	if strings.Join(kinds, ",") != "status,mimeType,body" {
+		t.Errorf("kinds: got %v", kinds)
+	}
+}
+
+func TestReceiptCompareEncoded(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		if r.URL.Path == "/broken" {
+			_, _ = io.WriteString(w, `{"a":2}`)
+			return
+		}
+		gw := gzip.NewWriter(w)
+		_, _ = io.WriteString(gw, `{"a":2}`)
+		_ = gw.Close()
+	}))
+	defer srv.Close()
+
+	har := newReplayHar(srv.URL, []string{"/", "/broken"}, []time.Duration{0, 1})
+	for _, e := range har.Log.Entries {
+		// browsers record the Accept-Encoding header, the transport keeps the body encoded
+		e.Request.Headers = []*NVP{{Name: "Accept-Encoding", Value: "gzip"}}
+		e.Response = &Response{
+			Status:  http.StatusOK,
+			Headers: []*NVP{{Name: "Content-Encoding", Value: "gzip"}},
+			Content: &Content{MimeType: "application/json", Text: []byte(`{"a":1}`)},
+		}
+	}
+	h, err := NewHandler(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipts, err := h.Execute(context.TODO())
+	if err != nil {
+		t.Fatalf("Execute: %s", err)
+	}
+
+	var got []string
+	for _, d := range receipts[0].Compare().Diffs {
+		got = append(got, d.String())
+	}
+	if want := `body.changed $.a: want "1", got "2"`; strings.Join(got, "\n") != want {
+		t.Errorf("gzip diffs: got %q, want %q", got, want)
+	}
+
+	diffs := receipts[1].Compare().Diffs
+	if len(diffs) != 1 || diffs[0].Kind != DiffBody {
+		t.Errorf("undecodable diffs: got %v", diffs)
+	}
+}
+
+func TestWithIgnoreJSONPathsInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("WithIgnoreJSONPaths: want a panic")
+		}
+	}()
+	WithIgnoreJSONPaths("$.id", "$.items[*")
+}
@@ -25,19 +25,25 @@ package go_har
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"iter"
 	"mime"
 	"mime/multipart"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
 	"net/url"
 	"os"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -59,23 +65,39 @@ type Handler struct {
 	har         *Har
 	mu          sync.Mutex
 	entries     map[string]*Entry
+	page        string // current page id
+	stream      *StreamWriter
 	transport   http.RoundTripper
 	log         Logger
 	cookie      bool
+	strict      bool
+	timeout     time.Duration
+	jar         http.CookieJar
+	retry       RetryPolicy
+	limit       *limiter
+	hostLimit   *hostLimiter
+	speed       float64 // faithful timing speed, 0 when disabled
+	streamBody  bool
+	maxBody     int64
+	recordLimit int64
+	sortByTime  bool
 	comment     string
 	reqBody     []ReqHandler
 	respBody    []RespHandler
+	uploads     []fileOpener
 	concurrency atomic.Int64 // default runtime.NumCPU()
+	seq         atomic.Uint64
 	// reqHandler  []EntityHandler
 	// respHandler []EntityHandler
 }
 
 func Parse(path string, opts ...Option) (*Handler, error) {
-	data, err := os.ReadFile(path)
+	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
-	return NewReader(bytes.NewReader(data), opts...)
+	defer file.Close()
+	return NewReader(file, opts...)
 }
 
 func NewReader(r io.Reader, opts ...Option) (*Handler, error) {
@@ -86,18 +108,7 @@ func NewReader(r io.Reader, opts ...Option) (*Handler, error) {
 	if err := decode.Decode(&har); err != nil {
 		return nil, fmt.Errorf("decode: %w", err)
 	}
-	h, err := NewHandler(&har, opts...)
-	if err != nil {
-		return nil, err
-	}
-	for _, e := range har.Log.Entries {
-		// Since PageRef is an optional field, there will be many duplicates,
-		// so we only record records that are not empty
-		if e.PageRef != "" {
-			h.entries[e.PageRef] = e
-		}
-	}
-	return h, nil
+	return NewHandler(&har, opts...)
 }
 
 func NewHandler(har *Har, opts ...Option) (*Handler, error) {
@@ -109,6 +120,7 @@ func NewHandler(har *Har, opts ...Option) (*Handler, error) {
 					Name:    "go-har",
 					Version: "0.0.1",
 				},
+				Entries: []*Entry{},
 			},
 		},
 		mu:      sync.Mutex{},
@@ -127,17 +139,36 @@ func NewHandler(har *Har, opts ...Option) (*Handler, error) {
 		},
 	}
 	if har != nil {
+		// a Har built in code is filled in to be recorded into
+		if har.Log == nil {
+			har.Log = h.har.Log
+		} else if har.Log.Entries == nil {
+			har.Log.Entries = []*Entry{}
+		}
 		h.har = har
 	}
-	if err := h.har.Validate(); err != nil {
-		return nil, err
+	if h.har.Log != nil {
+		for _, e := range h.har.Log.Entries {
+			if e == nil {
+				continue
+			}
+			// entries of third-party tools have no id or may have been merged
+			if _, exists := h.entries[e.ID]; e.ID == "" || exists {
+				e.ID = h.newID()
+			}
+			h.entries[e.ID] = e
+		}
 	}
 	h.setOption(WithRequestBody(true))
 	h.setOption(WithResponseBody(true))
 	h.setOption(WithCookie(true))
+	h.setOption(WithRecordBodyLimit(defaultRecordBodyLimit))
 	h.setOption(WithRequestConcurrency(uint64(runtime.NumCPU())))
 	h.setOption(WithLogger(NewLogger("text", "info")))
 	h.setOption(opts...)
+	if err := h.har.Validate(h.strict); err != nil {
+		return nil, err
+	}
 	return h, nil
 }
 
@@ -150,12 +181,31 @@ func (h *Handler) setOption(opts ...Option) {
 	}
 }
 
-// Export Har structure data
+// Export Har structure data, only the entries matching all the filters are
+// exported if any is given.
 // Note: The exported data is a copy object, and modifying the Har does not affect the original value
-func (h *Handler) Export() *Har {
+func (h *Handler) Export(filter ...RequestOption) *Har {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	return h.export(filter...)
+}
+
+func (h *Handler) export(filter ...RequestOption) *Har {
 	har := *h.har
+	if len(filter) == 0 || har.Log == nil {
+		return &har
+	}
+	var (
+		log   = *har.Log
+		match = All(filter...)
+	)
+	log.Entries = make([]*Entry, 0, len(har.Log.Entries))
+	for _, e := range har.Log.Entries {
+		if e != nil && e.Request != nil && match(h, e) {
+			log.Entries = append(log.Entries, e)
+		}
+	}
+	har.Log = &log
 	return &har
 }
 
@@ -164,12 +214,14 @@ func (h *Handler) Reset() {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	h.entries = make(map[string]*Entry)
+	h.page = ""
 	h.har = &Har{Log: &Log{
 		Version: "1.2",
 		Creator: &Creator{
 			Name:    "go-har",
 			Version: "0.0.1",
 		},
+		Entries: []*Entry{},
 	}}
 }
 
@@ -183,12 +235,13 @@ func (h *Handler) EntryTotal() int64 {
 	return int64(len(h.har.Log.Entries))
 }
 
-// Write writes the Har data to the writer
-func (h *Handler) Write(w io.Writer) error {
+// Write writes the Har data to the writer, only the entries matching all the
+// filters are written if any is given.
+func (h *Handler) Write(w io.Writer, filter ...RequestOption) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	// SetEscapeHTML(true) ?
-	if err := json.NewEncoder(w).Encode(h.har); err != nil {
+	if err := json.NewEncoder(w).Encode(h.export(filter...)); err != nil {
 		return err
 	}
 	return nil
@@ -200,54 +253,122 @@ func (h *Handler) AddRequest(id string, r *http.Request) error {
 	if err != nil {
 		return err
 	}
+	return h.addEntry(id, h.newEntry(time.Now(), req))
+}
+
+// AddResponse Add an http.Response to Har if the data exists,
+// overwrite it, otherwise, no operation is performed
+func (h *Handler) AddResponse(id string, resp *http.Response) error {
+	nr, err := NewResponse(resp, h.isRespBody(resp))
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	e, ok := h.entries[id]
+	if ok {
+		nr.Comment = h.comment
+		e.Response = nr
+		// the phases of an exchange sent by the caller are unknown,
+		// so the whole elapsed time is accounted as waiting.
+		t, _ := ParseISO8601(e.StartedDateTime)
+		e.Timings = &Timings{Blocked: -1, DNS: -1, Connect: -1, Ssl: -1, Wait: millis(time.Since(t))}
+		e.Time = e.Timings.total()
+	}
+	h.mu.Unlock()
+
+	if ok {
+		h.complete(id)
+	}
+	return nil
+}
 
-	var entry = Entry{
-		PageRef:         id,
-		StartedDateTime: time.Now().UTC().Format(time.RFC3339Nano),
+// newEntry returns an Entry for req whose response is not yet known.
+func (h *Handler) newEntry(started time.Time, req *Request) *Entry {
+	return &Entry{
+		StartedDateTime: started.UTC().Format(time.RFC3339Nano),
 		Time:            -1,
 		Request:         req,
 		Response:        &Response{},
 		Cache:           &Cache{},
-		Timings:         &Timings{},
+		Timings:         &Timings{Blocked: -1, DNS: -1, Connect: -1, Ssl: -1},
 		Comment:         h.comment,
 	}
+}
 
+// addEntry appends entry to the Har and indexes it by id.
+// The entry belongs to the current page if one is started.
+func (h *Handler) addEntry(id string, entry *Entry) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
 	if _, exists := h.entries[id]; exists {
 		return fmt.Errorf("har: duplicate request id: %s", id)
 	}
-	h.entries[id] = &entry
-	h.har.Log.Entries = append(h.har.Log.Entries, &entry)
+	if entry.PageRef == "" {
+		entry.PageRef = h.page
+	}
+	entry.ID = id
+	h.entries[id] = entry
+	h.har.Log.Entries = append(h.har.Log.Entries, entry)
 	return nil
 }
 
-// AddResponse Add an http.Response to Har if the data exists,
-// overwrite it, otherwise, no operation is performed
-func (h *Handler) AddResponse(id string, resp *http.Response) error {
-	nr, err := NewResponse(resp, h.isRespBody(resp))
-	if err != nil {
-		return err
+// nextID generates a unique id for internally recorded entries.
+func (h *Handler) nextID() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.newID()
+}
+
+func (h *Handler) newID() string {
+	for {
+		var id = fmt.Sprintf("go-har-%d", h.seq.Add(1))
+		if _, exists := h.entries[id]; !exists {
+			return id
+		}
 	}
+}
 
+// Entry returns the entry with the given id or nil if it does not exist.
+func (h *Handler) Entry(id string) *Entry {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	return h.entries[id]
+}
 
-	if e, ok := h.entries[id]; ok {
-		nr.Comment = h.comment
-		e.Response = nr
-		t, _ := ParseISO8601(e.StartedDateTime)
-		e.Time = float64(time.Since(t).Microseconds())
-		for _, e := range h.har.Log.Entries {
-			if e.PageRef != "" && e.PageRef == id {
-				e.Response = nr
-			}
-		}
+// RemoveEntry removes the entry with the given id from the Har.
+func (h *Handler) RemoveEntry(id string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e, ok := h.entries[id]
+	if !ok {
+		return fmt.Errorf("go-har: entry not found: %s", id)
 	}
+	delete(h.entries, id)
+	h.har.Log.Entries = slices.DeleteFunc(h.har.Log.Entries, func(v *Entry) bool {
+		return v == e
+	})
 	return nil
 }
 
+// UpdateEntry calls fn to modify the entry with the given id while holding the
+// Handler lock, fn must not call other methods of the Handler.
+// The id of the entry cannot be changed.
+func (h *Handler) UpdateEntry(id string, fn func(e *Entry) error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e, ok := h.entries[id]
+	if !ok {
+		return fmt.Errorf("go-har: entry not found: %s", id)
+	}
+	err := fn(e)
+	e.ID = id
+	return err
+}
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		w.Header().Add("Allow", "GET")
@@ -265,24 +386,17 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// SyncExecute concurrent execution http request.
-// Note: The order of execution is not guaranteed
+// SyncExecute concurrent execution http request of the entries matching all the filters.
+// Requests are sent in the order of the Har, see WithSortByStartedDateTime.
+// Once ctx is done, the entries not sent yet are received with the error of ctx,
+// e.g. context.Canceled, and the channel is closed when the requests in flight return.
+// Note: The order of completion is not guaranteed
 func (h *Handler) SyncExecute(ctx context.Context, filter ...RequestOption) (<-chan Receipt, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
-	var entries = make(map[int]*Entry)
-	h.mu.Lock()
-	for i, entry := range h.har.Log.Entries {
-		for _, f := range filter {
-			if !f(h, entry) {
-				continue
-			}
-			entries[i] = entry
-		}
-	}
-	h.mu.Unlock()
+	var entries = h.selectEntries(filter...)
 
 	if len(entries) <= 0 {
 		var receipt = make(chan Receipt, 1)
@@ -293,73 +407,55 @@ func (h *Handler) SyncExecute(ctx context.Context, filter ...RequestOption) (<-c
 	var (
 		receipt     = make(chan Receipt, len(entries))
 		concurrency = h.concurrency.Load()
-		client      = &http.Client{
-			Transport: h.transport,
-			CheckRedirect: func(r *http.Request, via []*http.Request) error {
-				r.URL.Opaque = r.URL.Path
-				return nil
-			},
-		}
+		client      = h.client()
 	)
 
 	// if concurrency <= 0 then no limit
 	if concurrency <= 0 {
 		concurrency = int64(len(entries))
 	}
-	var sema = semaphore.NewWeighted(concurrency)
+	var (
+		sema  = semaphore.NewWeighted(concurrency)
+		sched = h.newSchedule(entries)
+		wg    sync.WaitGroup
+	)
 
 	go func() {
-		for i, e := range entries {
-			var (
-				index = i
-				entry = e
-			)
-			if err := sema.Acquire(ctx, 1); err != nil {
-				h.log.Error("go-har: semaphore acquire failed: %s", err)
+		for i, entry := range entries {
+			sched.wait(ctx, entry)
+			if err := sema.Acquire(ctx, 1); err != nil || ctx.Err() != nil {
+				if err == nil {
+					sema.Release(1)
+				}
+				// the remaining entries are never sent
+				for _, e := range entries[i:] {
+					receipt <- Receipt{h: h, Entry: e, err: ctx.Err()}
+				}
+				break
 			}
+			wg.Add(1)
 			go func() {
+				defer wg.Done()
 				defer sema.Release(1)
-				// reset Entry.Time time ?
-				var body []byte
-				response, err := h.run(ctx, client, entry, true)
-				if err == nil && response != nil {
-					defer response.Body.Close()
-					// todo: 当请求时下载文件请求时会造成内存过大，因此需要优化掉
-					body, err = io.ReadAll(response.Body)
-					if err != nil {
-						h.log.Error("go-har: read body filed: %s", err)
-					} else {
-						response.Body = io.NopCloser(bytes.NewReader(body))
-					}
-				}
-				receipt <- Receipt{h: h, index: index, Entry: entry, Response: response, body: body, err: err}
+				receipt <- h.replay(ctx, client, entry, h.cookie)
 			}()
 		}
-		if err := sema.Acquire(ctx, concurrency); err != nil {
-			h.log.Error("go-har: semaphore wait failed: %s", err)
-		}
+		wg.Wait()
 		close(receipt)
 	}()
 	return receipt, nil
 }
 
-// Execute sequential synchronous http execution
+// Execute sequential synchronous http execution of the entries matching all
+// the filters. Requests are sent in the order
+// of the Har, see WithSortByStartedDateTime, and receipts are returned in that order.
+// Once ctx is done, the receipts of the entries not sent hold the error of ctx.
 func (h *Handler) Execute(ctx context.Context, filter ...RequestOption) ([]Receipt, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
-	var entries = make(map[int]*Entry)
-	h.mu.Lock()
-	for index, entry := range h.har.Log.Entries {
-		for _, f := range filter {
-			if !f(h, entry) {
-				continue
-			}
-			entries[index] = entry
-		}
-	}
-	h.mu.Unlock()
+	var entries = h.selectEntries(filter...)
 
 	if len(entries) <= 0 {
 		return make([]Receipt, 0), nil
@@ -367,34 +463,239 @@ func (h *Handler) Execute(ctx context.Context, filter ...RequestOption) ([]Recei
 
 	var (
 		receipt = make([]Receipt, 0, len(entries))
-		client  = &http.Client{
-			Transport: h.transport,
-			CheckRedirect: func(r *http.Request, via []*http.Request) error {
-				r.URL.Opaque = r.URL.Path
-				return nil
-			},
+		client  = h.client()
+	)
+
+	var sched = h.newSchedule(entries)
+	for _, entry := range entries {
+		sched.wait(ctx, entry)
+		receipt = append(receipt, h.replay(ctx, client, entry, h.cookie))
+	}
+	return receipt, nil
+}
+
+// Replay is the iterator form of Execute, it yields the receipts of the entries
+// matching all the filters with their error in the order they are sent.
+// Breaking out of the loop cancels the requests left, the yielded receipts
+// must not be used after the loop when WithResponseStream is enabled.
+func (h *Handler) Replay(ctx context.Context, filter ...RequestOption) iter.Seq2[Receipt, error] {
+	return func(yield func(Receipt, error) bool) {
+		if ctx == nil {
+			ctx = context.Background()
 		}
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var (
+			client  = h.client()
+			entries = h.selectEntries(filter...)
+			sched   = h.newSchedule(entries)
+		)
+		for _, entry := range entries {
+			sched.wait(ctx, entry)
+			var r = h.replay(ctx, client, entry, h.cookie)
+			if !yield(r, r.err) {
+				return
+			}
+		}
+	}
+}
+
+// SyncReplay is the iterator form of SyncExecute, it yields the receipts of the
+// entries matching all the filters with their error as the requests complete.
+// Breaking out of the loop cancels the requests in flight and the ones left,
+// and waits for them to return. The yielded receipts must not be used after
+// the loop when WithResponseStream is enabled.
+func (h *Handler) SyncReplay(ctx context.Context, filter ...RequestOption) iter.Seq2[Receipt, error] {
+	return func(yield func(Receipt, error) bool) {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		receipt, err := h.SyncExecute(ctx, filter...)
+		if err != nil {
+			yield(Receipt{h: h, err: err}, err)
+			return
+		}
+		for r := range receipt {
+			if !yield(r, r.err) {
+				cancel()
+				for r := range receipt {
+					r.discard()
+				}
+				return
+			}
+		}
+	}
+}
+
+// client returns the http.Client replaying the entries.
+func (h *Handler) client() *http.Client {
+	return &http.Client{
+		Transport: h.transport,
+		Jar:       h.jar,
+		CheckRedirect: func(r *http.Request, via []*http.Request) error {
+			r.URL.Opaque = r.URL.Path
+			return nil
+		},
+	}
+}
+
+// seedJar sets the recorded cookies of the request of e in jar, unless the jar
+// has already a cookie of the same name for the url, e.g. received while
+// replaying a previous entry. They are set as session cookies of the path /
+// so that an outdated expiry does not drop them.
+func seedJar(jar http.CookieJar, e *Entry) {
+	u, err := url.Parse(e.Request.URL)
+	if err != nil {
+		return
+	}
+
+	var recorded []*http.Cookie
+	for _, c := range e.Request.Cookies {
+		recorded = append(recorded, httpCookie(c))
+	}
+	if len(e.Request.Cookies) == 0 {
+		for _, h := range e.Request.Headers {
+			if strings.EqualFold(h.Name, "Cookie") {
+				cs, _ := http.ParseCookie(h.Value)
+				recorded = append(recorded, cs...)
+			}
+		}
+	}
+
+	var (
+		cs   []*http.Cookie
+		have = make(map[string]bool)
 	)
+	for _, c := range jar.Cookies(u) {
+		have[c.Name] = true
+	}
+	for _, c := range recorded {
+		if have[c.Name] {
+			continue
+		}
+		c.Path = cmp.Or(c.Path, "/")
+		c.Expires = time.Time{}
+		c.MaxAge = 0
+		cs = append(cs, c)
+	}
+	if len(cs) > 0 {
+		jar.SetCookies(u, cs)
+	}
+}
 
-	for index, entry := range entries {
-		// reset Entry.Time time ?
-		var body []byte
-		response, err := h.run(ctx, client, entry, h.cookie)
-		if err == nil && response != nil {
-			body, err = io.ReadAll(response.Body)
-			_ = response.Body.Close()
-			if err != nil {
-				h.log.Error("go-har: read body failed: %s", err)
-			} else {
-				response.Body = io.NopCloser(bytes.NewReader(body))
+// replay sends the request of entry and buffers its response in the returned
+// Receipt, or hands the response body over as it is received, see
+// WithResponseStream. The request is sent again as long as the retry policy
+// allows it, see WithRetry. The entry is not sent if ctx is done, the receipt
+// then holds the error of ctx.
+func (h *Handler) replay(ctx context.Context, cli *http.Client, entry *Entry, withCookie bool) Receipt {
+	if err := ctx.Err(); err != nil {
+		return Receipt{h: h, Entry: entry, err: err}
+	}
+	// the cookies of the session are sent by the jar
+	if cli.Jar != nil {
+		seedJar(cli.Jar, entry)
+		withCookie = false
+	}
+
+	var (
+		r        Receipt
+		attempts []error
+	)
+	for n := 1; ; n++ {
+		r = h.attempt(ctx, cli, entry, withCookie)
+		var err = h.retry.attemptError(&r)
+		attempts = append(attempts, err)
+		if err == nil || n >= h.retry.MaxAttempts || ctx.Err() != nil || !h.retry.retryable(&r) {
+			break
+		}
+
+		var wait = h.retry.backoff(n, r.Response)
+		h.log.Warn("go-har: %s %s attempt %d failed, retry in %s: %s",
+			entry.Request.Method, entry.Request.URL, n, wait, err)
+		r.discard()
+		if !sleep(ctx, wait) {
+			r = Receipt{h: h, Entry: entry, err: ctx.Err()}
+			break
+		}
+	}
+	r.attempts = attempts
+	return r
+}
+
+// attempt sends the request of entry once.
+func (h *Handler) attempt(ctx context.Context, cli *http.Client, entry *Entry, withCookie bool) Receipt {
+	if !h.pace(ctx, entry) {
+		return Receipt{h: h, Entry: entry, err: ctx.Err()}
+	}
+
+	// the timeout covers reading the response body
+	var cancel = context.CancelFunc(func() {})
+	if h.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+	}
+
+	// reset Entry.Time time ?
+	var tr = newTracer()
+	response, err := h.run(ctx, cli, entry, withCookie, tr)
+	if err != nil || response == nil {
+		cancel()
+		tr.finish()
+		return Receipt{h: h, Entry: entry, Response: response, tracer: tr, err: err}
+	}
+
+	var body = newBodyCapture(response.Body, h.maxBody, func() {
+		tr.finish()
+		cancel()
+	})
+	response.Body = body
+	if !h.streamBody {
+		_, err = io.Copy(io.Discard, body)
+		_ = body.Close()
+		if err != nil {
+			h.log.Error("go-har: read body failed: %s", err)
+		} else {
+			response.Body = body.reader()
+			if !body.complete() {
+				err = ErrBodyTruncated
 			}
 		}
-		receipt = append(receipt, Receipt{h: h, index: index, Entry: entry, Response: response, body: body, err: err})
 	}
-	return receipt, nil
+	return Receipt{h: h, Entry: entry, Response: response, body: body, tracer: tr, err: err}
+}
+
+// selectEntries returns the entries matching all the filters in replay order,
+// every entry is selected when there is no filter.
+func (h *Handler) selectEntries(filter ...RequestOption) []*Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var (
+		entries []*Entry
+		match   = All(filter...)
+	)
+	for _, entry := range h.har.Log.Entries {
+		if entry != nil && entry.Request != nil && match(h, entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	if h.sortByTime {
+		// entries with an invalid startedDateTime keep their relative order first
+		slices.SortStableFunc(entries, func(a, b *Entry) int {
+			ta, _ := ParseISO8601(a.StartedDateTime)
+			tb, _ := ParseISO8601(b.StartedDateTime)
+			return ta.Compare(tb)
+		})
+	}
+	return entries
 }
 
-func (h *Handler) run(ctx context.Context, cli *http.Client, entry *Entry, withCookie bool) (resp *http.Response, err error) {
+func (h *Handler) run(ctx context.Context, cli *http.Client, entry *Entry, withCookie bool, tr *tracer) (resp *http.Response, err error) {
 	defer func() {
 		if x := recover(); x != nil {
 			buf := make([]byte, 64<<10)
@@ -405,11 +706,11 @@ func (h *Handler) run(ctx context.Context, cli *http.Client, entry *Entry, withC
 		}
 	}()
 
-	request, err := EntryToRequest(entry, withCookie)
+	request, err := entryToRequest(entry, withCookie, h.openFile)
 	if err != nil {
 		return nil, fmt.Errorf("EntryToRequest: %w", err)
 	}
-	request.WithContext(ctx)
+	request = request.WithContext(httptrace.WithClientTrace(ctx, tr.clientTrace()))
 	resp, err = cli.Do(request)
 	return
 }
@@ -448,17 +749,22 @@ func NewRequest(req *http.Request, withBody bool) (*Request, error) {
 		Comment:     "",
 	}
 
-	for n, vs := range req.URL.Query() {
-		for _, v := range vs {
-			r.QueryString = append(r.QueryString, &NVP{
-				Name:    n,
-				Value:   v,
-				Comment: "",
-			})
-		}
+	var mv = messageview.New()
+	mv.SkipBody(!withBody)
+	if err := mv.SnapshotRequest(req); err != nil {
+		return nil, fmt.Errorf("SnapshotRequest: %w", err)
+	}
+	// the snapshot writes the absolute url on the request line while the
+	// request is sent with the origin form, e.g. "GET /path HTTP/1.1".
+	r.HeaderSize = mv.HeaderSize() - int64(len(req.URL.String())-len(req.URL.RequestURI()))
+	if withBody || req.ContentLength == 0 {
+		r.BodySize = mv.EncodedBodySize()
 	}
 
-	pd, err := postData(req, withBody)
+	// an invalid query string is kept as is in the url
+	r.QueryString, _ = parseQuery(req.URL.RawQuery)
+
+	pd, err := postData(req, mv, withBody)
 	if err != nil {
 		return nil, err
 	}
@@ -491,12 +797,14 @@ func NewResponse(res *http.Response, withBody bool) (*Response, error) {
 		r.RedirectURL = res.Header.Get("Location")
 	}
 
-	if withBody {
-		var mv = messageview.New()
-		if err := mv.SnapshotResponse(res); err != nil {
-			return nil, err
-		}
+	var mv = messageview.New()
+	mv.SkipBody(!withBody)
+	if err := mv.SnapshotResponse(res); err != nil {
+		return nil, err
+	}
+	r.HeadersSize = mv.HeaderSize()
 
+	if withBody {
 		reader, err := mv.BodyReader(messageview.Decode())
 		if err != nil {
 			return nil, err
@@ -509,12 +817,30 @@ func NewResponse(res *http.Response, withBody bool) (*Response, error) {
 
 		r.Content.Text = body
 		r.Content.Size = int64(len(body))
+		r.BodySize = mv.EncodedBodySize()
+		// bytes saved by the Content-Encoding of the body
+		if c := r.Content.Size - r.BodySize; c > 0 && res.Header.Get("Content-Encoding") != "" {
+			r.Content.Compression = c
+		}
+	}
+	// the transport decoded the body, its size on the wire is unknown
+	if res.Uncompressed {
+		r.BodySize = -1
 	}
 	return r, nil
 }
 
-// EntryToRequest .
+// EntryToRequest rebuilds the http.Request recorded in the entry. The url, the
+// headers, the body and, if withCookie is true, the cookies are restored as
+// they were recorded. Host and HTTP/2 pseudo-headers set the request Host,
+// while Content-Length and Transfer-Encoding are computed from the body.
 func EntryToRequest(e *Entry, withCookie bool) (*http.Request, error) {
+	return entryToRequest(e, withCookie, nil)
+}
+
+// entryToRequest is EntryToRequest with the file parts of a multipart body
+// opened by open, see postBody.
+func entryToRequest(e *Entry, withCookie bool, open fileOpener) (*http.Request, error) {
 	if e == nil || e.Request == nil {
 		return nil, errors.New("go-har: entry or request is empty")
 	}
@@ -524,57 +850,217 @@ func EntryToRequest(e *Entry, withCookie bool) (*http.Request, error) {
 	if err != nil {
 		return nil, err
 	}
-	for _, v := range req.QueryString {
-		_url.Query().Add(v.Name, v.Value)
+	// the url normally contains the query string already
+	if _url.RawQuery == "" && len(req.QueryString) > 0 {
+		_url.RawQuery = encodeQuery(req.QueryString)
 	}
 
-	var body string
-	if req.PostData != nil {
-		if len(req.PostData.Params) == 0 {
-			body = req.PostData.Text
-		} else {
-			var form = make(url.Values)
-			for _, p := range req.PostData.Params {
-				form.Add(p.Name, p.Value)
-			}
-			body = form.Encode()
-		}
+	body, contentType, err := postBody(req.PostData, open)
+	if err != nil {
+		return nil, err
 	}
 
-	request, err := http.NewRequest(req.Method, _url.String(), strings.NewReader(body))
+	request, err := http.NewRequest(req.Method, _url.String(), bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
+
+	var cookieHeader []string
 	for _, h := range req.Headers {
-		if httpguts.ValidHeaderFieldName(h.Name) &&
-			httpguts.ValidHeaderFieldValue(h.Value) &&
-			h.Name != "Cookie" {
-			request.Header.Add(h.Name, h.Name)
+		switch {
+		case strings.EqualFold(h.Name, "Host") || h.Name == ":authority":
+			request.Host = h.Value
+			continue
+		case strings.HasPrefix(h.Name, ":"):
+			// the other HTTP/2 pseudo-headers are derived from the method and url
+			continue
+		case strings.EqualFold(h.Name, "Cookie"):
+			cookieHeader = append(cookieHeader, h.Value)
+			continue
+		case strings.EqualFold(h.Name, "Content-Length"),
+			strings.EqualFold(h.Name, "Transfer-Encoding"),
+			// the recorded post data is decoded
+			strings.EqualFold(h.Name, "Content-Encoding"):
+			continue
 		}
+		if httpguts.ValidHeaderFieldName(h.Name) && httpguts.ValidHeaderFieldValue(h.Value) {
+			request.Header.Add(h.Name, h.Value)
+		}
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
 	}
 
 	if !withCookie {
 		return request, nil
 	}
 
-	for _, c := range req.Cookies {
-		var expires time.Time
-		if c.Expires != "" {
-			expires, _ = time.Parse(c.Expires, time.RFC3339Nano)
+	if len(req.Cookies) == 0 {
+		for _, v := range cookieHeader {
+			request.Header.Add("Cookie", v)
 		}
-		request.AddCookie(&http.Cookie{
-			Name:     c.Name,
-			Value:    c.Value,
-			Path:     c.Path,
-			Domain:   c.Domain,
-			Expires:  expires,
-			Secure:   c.Secure,
-			HttpOnly: c.HTTPOnly,
-		})
+		return request, nil
+	}
+	for _, c := range req.Cookies {
+		request.AddCookie(httpCookie(c))
 	}
 	return request, nil
 }
 
+// fileOpener opens the file substituted for the file part p of a multipart
+// body, it returns a nil reader when the recorded value is sent.
+type fileOpener func(p *PostParam) (io.ReadCloser, error)
+
+// postBody returns the body described by pd. The content type is returned
+// when it differs from the recorded one, e.g. a new multipart boundary.
+// The file parts of a multipart body are read with open if it is not nil.
+func postBody(pd *PostData, open fileOpener) ([]byte, string, error) {
+	if pd == nil {
+		return nil, "", nil
+	}
+
+	mt, ps, err := mime.ParseMediaType(pd.MimeType)
+	if err != nil {
+		mt = pd.MimeType
+	}
+	// the text is the body as it was sent, params are only a parsed view of it,
+	// unless the files of a multipart body are substituted.
+	if len(pd.Params) == 0 || (pd.Text != "" && (mt != "multipart/form-data" || open == nil)) {
+		return []byte(pd.Text), "", nil
+	}
+	if mt != "multipart/form-data" {
+		var form = make([]string, 0, len(pd.Params))
+		for _, p := range pd.Params {
+			form = append(form, url.QueryEscape(p.Name)+"="+url.QueryEscape(p.Value))
+		}
+		return []byte(strings.Join(form, "&")), "", nil
+	}
+
+	var (
+		buf bytes.Buffer
+		mw  = multipart.NewWriter(&buf)
+		ct  string
+	)
+	if boundary := ps["boundary"]; boundary != "" {
+		if err := mw.SetBoundary(boundary); err != nil {
+			return nil, "", fmt.Errorf("SetBoundary: %w", err)
+		}
+	} else {
+		ct = mw.FormDataContentType()
+	}
+	for _, p := range pd.Params {
+		var header = make(textproto.MIMEHeader)
+		if p.FileName != "" {
+			header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+				quoteEscaper.Replace(p.Name), quoteEscaper.Replace(p.FileName)))
+		} else {
+			header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(p.Name)))
+		}
+		if p.ContentType != "" {
+			header.Set("Content-Type", p.ContentType)
+		}
+		w, err := mw.CreatePart(header)
+		if err != nil {
+			return nil, "", fmt.Errorf("CreatePart: %w", err)
+		}
+		if err := writePart(w, p, open); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), ct, nil
+}
+
+// writePart writes the content of the multipart part p to w, a file part is
+// read from the file opened by open if any.
+func writePart(w io.Writer, p *PostParam, open fileOpener) error {
+	if p.FileName != "" && open != nil {
+		f, err := open(p)
+		if err != nil {
+			return fmt.Errorf("open %s: %w", p.FileName, err)
+		}
+		if f != nil {
+			defer f.Close()
+			_, err = io.Copy(w, f)
+			return err
+		}
+	}
+	_, err := io.WriteString(w, p.Value)
+	return err
+}
+
+// openFile opens the file substituted for the file part p by the first upload
+// source that has it, see WithUploadFS.
+func (h *Handler) openFile(p *PostParam) (io.ReadCloser, error) {
+	for _, open := range h.uploads {
+		f, err := open(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil || f != nil {
+			return f, err
+		}
+	}
+	return nil, nil
+}
+
+// quoteEscaper escapes the quoted values of a Content-Disposition as mime/multipart does.
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// encodeQuery encodes the query string parameters in their order.
+func encodeQuery(nvps []*NVP) string {
+	var query = make([]string, 0, len(nvps))
+	for _, v := range nvps {
+		query = append(query, url.QueryEscape(v.Name)+"="+url.QueryEscape(v.Value))
+	}
+	return strings.Join(query, "&")
+}
+
+// parseQuery parses a query string keeping the order of the parameters.
+func parseQuery(query string) ([]*NVP, error) {
+	var (
+		nvps     []*NVP
+		firstErr error
+	)
+	for _, kv := range strings.Split(query, "&") {
+		if kv == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(kv, "=")
+		name, err := url.QueryUnescape(k)
+		if err != nil {
+			firstErr = cmp.Or(firstErr, err)
+			continue
+		}
+		value, err := url.QueryUnescape(v)
+		if err != nil {
+			firstErr = cmp.Or(firstErr, err)
+			continue
+		}
+		nvps = append(nvps, &NVP{Name: name, Value: value})
+	}
+	return nvps, firstErr
+}
+
+// httpCookie converts a Har cookie into an http.Cookie.
+func httpCookie(c *Cookie) *http.Cookie {
+	var expires time.Time
+	if c.Expires != "" {
+		expires, _ = ParseISO8601(c.Expires)
+	}
+	return &http.Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Path:     c.Path,
+		Domain:   c.Domain,
+		Expires:  expires,
+		Secure:   c.Secure,
+		HttpOnly: c.HTTPOnly,
+	}
+}
+
 func cookies(cs []*http.Cookie) []*Cookie {
 	var hcs = make([]*Cookie, 0, len(cs))
 	for _, c := range cs {
@@ -609,23 +1095,30 @@ func headers(header http.Header) []*NVP {
 	return hs
 }
 
-func postData(req *http.Request, withBody bool) (*PostData, error) {
+func postData(req *http.Request, mv *messageview.MessageView, withBody bool) (*PostData, error) {
 	// If the request has No body (no Content-Length and Transfer-Encoding isn't
 	// chunked), skip the post-data.
 	if req.ContentLength <= 0 && len(req.TransferEncoding) == 0 {
 		return nil, nil
 	}
 
-	var ct = req.Header.Get("Content-Type")
-	mt, ps, err := mime.ParseMediaType(ct)
-	if err != nil {
-		// log.Printf("go-har: cannot parse Content-Type header %q: %v", ct, err)
-		// mt = ct
-		return nil, fmt.Errorf("ParseMediaType: %w", err)
+	var (
+		ct = req.Header.Get("Content-Type")
+		mt string
+		ps map[string]string
+	)
+	if ct != "" {
+		var err error
+		mt, ps, err = mime.ParseMediaType(ct)
+		if err != nil {
+			return nil, fmt.Errorf("ParseMediaType: %w", err)
+		}
 	}
 
+	// like browsers the mime type keeps its parameters, such as the
+	// multipart boundary needed to rebuild the body on replay.
 	pd := &PostData{
-		MimeType: mt,
+		MimeType: ct,
 		Params:   []*PostParam{},
 		Comment:  "",
 	}
@@ -634,11 +1127,7 @@ func postData(req *http.Request, withBody bool) (*PostData, error) {
 		return pd, nil
 	}
 
-	var mv = messageview.New()
-	if err := mv.SnapshotRequest(req); err != nil {
-		return nil, fmt.Errorf("SnapshotRequest: %w", err)
-	}
-	br, err := mv.BodyReader()
+	br, err := mv.BodyReader(messageview.Decode())
 	if err != nil {
 		return nil, fmt.Errorf("BodyReader: %w", err)
 	}
@@ -676,20 +1165,19 @@ func postData(req *http.Request, withBody bool) (*PostData, error) {
 			return nil, fmt.Errorf("ReadAll: %w", err)
 		}
 
-		vs, err := url.ParseQuery(string(body))
+		vs, err := parseQuery(string(body))
 		if err != nil {
 			return nil, fmt.Errorf("ParseQuery: %w", err)
 		}
-
-		for n, vs := range vs {
-			for _, v := range vs {
-				pd.Params = append(pd.Params, &PostParam{
-					Name:    n,
-					Value:   v,
-					Comment: "",
-				})
-			}
+		for _, v := range vs {
+			pd.Params = append(pd.Params, &PostParam{
+				Name:    v.Name,
+				Value:   v.Value,
+				Comment: "",
+			})
 		}
+		// the text keeps the body as it was sent
+		pd.Text = string(body)
 	default:
 		body, err := io.ReadAll(br)
 		if err != nil {
@@ -700,12 +1188,18 @@ func postData(req *http.Request, withBody bool) (*PostData, error) {
 	return pd, nil
 }
 
+// ErrBodyTruncated is the error of a receipt whose response body was longer
+// than the limit of WithMaxBodyCapture, Receipt.Response.Body holds the
+// beginning of it only.
+var ErrBodyTruncated = errors.New("go-har: response body truncated")
+
 type Receipt struct {
 	h        *Handler
-	index    int
 	Entry    *Entry
 	Response *http.Response
-	body     []byte
+	body     *bodyCapture
+	tracer   *tracer
+	attempts []error
 	err      error
 }
 
@@ -713,16 +1207,87 @@ func (r *Receipt) Error() error {
 	return r.err
 }
 
+// Attempts returns the number of times the request was sent, see WithRetry.
+func (r *Receipt) Attempts() int {
+	return len(r.attempts)
+}
+
+// AttemptErrors returns the error of each attempt in order, the error of the
+// last attempt is nil if it succeeded. A retried response status is reported
+// as a *StatusError.
+func (r *Receipt) AttemptErrors() []error {
+	return slices.Clone(r.attempts)
+}
+
+// discard closes the response body of a receipt the caller never gets.
+func (r *Receipt) discard() {
+	if r.Response != nil && r.Response.Body != nil {
+		_ = r.Response.Body.Close()
+	}
+}
+
+// Body returns the response body captured so far, at most the bytes allowed by
+// WithMaxBodyCapture. With WithResponseStream, it is complete once
+// Response.Body has been read to the end.
 func (r *Receipt) Body() []byte {
-	return r.body
+	if r.body == nil {
+		return nil
+	}
+	return r.body.Bytes()
+}
+
+// DecodedBody returns the body captured so far like Body, decoded according to
+// the Content-Encoding of the response. The encoding is not removed by the
+// transport when the recorded request has an Accept-Encoding header.
+func (r *Receipt) DecodedBody() ([]byte, error) {
+	if r.Response == nil {
+		return nil, nil
+	}
+	var (
+		body = r.Body()
+		res  = &http.Response{
+			Status:        r.Response.Status,
+			StatusCode:    r.Response.StatusCode,
+			Proto:         r.Response.Proto,
+			ProtoMajor:    r.Response.ProtoMajor,
+			ProtoMinor:    r.Response.ProtoMinor,
+			Header:        r.Response.Header,
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+		}
+		mv = messageview.New()
+	)
+	if err := mv.SnapshotResponse(res); err != nil {
+		return nil, err
+	}
+	br, err := mv.BodyReader(messageview.Decode())
+	if err != nil {
+		return nil, fmt.Errorf("decode body: %w", err)
+	}
+	defer br.Close()
+	body, err = io.ReadAll(br)
+	if err != nil {
+		return nil, fmt.Errorf("decode body: %w", err)
+	}
+	return body, nil
 }
 
-// FillInResponse TODO: 读取body会造成内存过大考虑优化
+// Timings returns the timings measured while replaying the entry.
+func (r *Receipt) Timings() *Timings {
+	if r.tracer == nil {
+		return nil
+	}
+	return r.tracer.timings()
+}
+
+// FillInResponse records the replayed response in the entry. The body is
+// recorded from the captured bytes, it is left out if it was not entirely
+// captured, e.g. truncated by WithMaxBodyCapture or not read to the end.
 func (r *Receipt) FillInResponse(withBody ...bool) error {
 	if r.Entry == nil {
 		return errors.New("go-har: entry is nil")
 	}
-	if r.err != nil {
+	if r.err != nil && !errors.Is(r.err, ErrBodyTruncated) {
 		return r.err
 	}
 
@@ -732,20 +1297,100 @@ func (r *Receipt) FillInResponse(withBody ...bool) error {
 	} else {
 		wb = withBody[0]
 	}
-	if r.Response.Body == nil {
+	if r.Response.Body == nil || r.body == nil {
 		return errors.New("go-har: response body is nil")
 	}
-	if wb {
-		r.Response.Body = io.NopCloser(bytes.NewReader(r.body))
+	var complete = r.body.complete()
+	if wb && complete {
+		r.Response.Body = r.body.reader()
 	}
-	resp, err := NewResponse(r.Response, wb)
+	resp, err := NewResponse(r.Response, wb && complete)
 	if err != nil {
 		return err
 	}
+	if wb && !complete {
+		resp.BodySize = r.body.Size()
+		resp.Content.Comment = fmt.Sprintf("go-har: body not captured, %d bytes received", resp.BodySize)
+	}
 
 	r.h.mu.Lock()
 	defer r.h.mu.Unlock()
+	if e, ok := r.h.entries[r.Entry.ID]; !ok || e != r.Entry {
+		return fmt.Errorf("go-har: entry not found: %s", r.Entry.ID)
+	}
 	r.Entry.Response = resp
-	r.h.har.Log.Entries[r.index].Response = resp
+	if r.tracer != nil {
+		r.Entry.StartedDateTime = r.tracer.start.UTC().Format(time.RFC3339Nano)
+		r.tracer.apply(r.Entry)
+	}
 	return nil
 }
+
+// bodyCapture reads a response body keeping at most limit bytes of it in
+// memory, 0 indicates no limit. done is called once the body is closed.
+type bodyCapture struct {
+	rc    io.ReadCloser
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	limit int64
+	size  int64
+	eof   bool
+	once  sync.Once
+	done  func()
+}
+
+func newBodyCapture(rc io.ReadCloser, limit int64, done func()) *bodyCapture {
+	return &bodyCapture{rc: rc, limit: limit, done: done}
+}
+
+func (c *bodyCapture) Read(p []byte) (int, error) {
+	n, err := c.rc.Read(p)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var keep = int64(n)
+	if c.limit > 0 {
+		keep = max(0, min(keep, c.limit-c.size))
+	}
+	c.buf.Write(p[:keep])
+	c.size += int64(n)
+	if errors.Is(err, io.EOF) {
+		c.eof = true
+	}
+	return n, err
+}
+
+func (c *bodyCapture) Close() error {
+	var err = c.rc.Close()
+	c.once.Do(c.done)
+	return err
+}
+
+// Bytes returns the captured bytes of the body.
+func (c *bodyCapture) Bytes() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return bytes.Clone(c.buf.Bytes())
+}
+
+// reader returns a reader over the captured bytes sharing the buffer of c,
+// the body must have been read and closed.
+func (c *bodyCapture) reader() io.ReadCloser {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return io.NopCloser(bytes.NewReader(c.buf.Bytes()))
+}
+
+// Size returns the number of bytes of the body read so far.
+func (c *bodyCapture) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// complete reports whether the whole body was read and captured.
+func (c *bodyCapture) complete() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.eof && int64(c.buf.Len()) == c.size
+}
@@ -24,10 +24,24 @@
 package go_har
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestParse(t *testing.T) {
@@ -97,3 +111,720 @@ func TestExecute(t *testing.T) {
 		}()
 	}
 }
+
+func TestNewResponseSize(t *testing.T) {
+	var (
+		buf  bytes.Buffer
+		text = strings.Repeat("go-har ", 100)
+	)
+	gw := gzip.NewWriter(&buf)
+	_, _ = gw.Write([]byte(text))
+	_ = gw.Close()
+	wire := int64(buf.Len())
+
+	res := &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Encoding": {"gzip"}, "Content-Type": {"text/plain"}},
+		Body:          io.NopCloser(&buf),
+		ContentLength: wire,
+	}
+	r, err := NewResponse(res, true)
+	if err != nil {
+		t.Fatalf("NewResponse: %s", err)
+	}
+
+	header := "HTTP/1.1 200 OK\r\n" +
+		"Content-Length: " + strconv.FormatInt(wire, 10) + "\r\n" +
+		"Content-Encoding: gzip\r\n" +
+		"Content-Type: text/plain\r\n\r\n"
+	if r.HeadersSize != int64(len(header)) {
+		t.Errorf("headersSize: got %d, want %d", r.HeadersSize, len(header))
+	}
+	if r.BodySize != wire {
+		t.Errorf("bodySize: got %d, want %d", r.BodySize, wire)
+	}
+	if r.Content.Size != int64(len(text)) {
+		t.Errorf("content size: got %d, want %d", r.Content.Size, len(text))
+	}
+	if want := int64(len(text)) - wire; r.Content.Compression != want {
+		t.Errorf("content compression: got %d, want %d", r.Content.Compression, want)
+	}
+}
+
+func TestNewResponseSizeChunked(t *testing.T) {
+	var (
+		buf  bytes.Buffer
+		text = strings.Repeat("go-har ", 100)
+	)
+	gw := gzip.NewWriter(&buf)
+	_, _ = gw.Write([]byte(text))
+	_ = gw.Close()
+	encoded := int64(buf.Len())
+
+	res := &http.Response{
+		Status:           "200 OK",
+		StatusCode:       http.StatusOK,
+		Proto:            "HTTP/1.1",
+		ProtoMajor:       1,
+		ProtoMinor:       1,
+		Header:           http.Header{"Content-Encoding": {"gzip"}},
+		Body:             io.NopCloser(&buf),
+		ContentLength:    -1,
+		TransferEncoding: []string{"chunked"},
+	}
+	r, err := NewResponse(res, true)
+	if err != nil {
+		t.Fatalf("NewResponse: %s", err)
+	}
+	if r.BodySize != encoded {
+		t.Errorf("bodySize: got %d, want %d", r.BodySize, encoded)
+	}
+	if want := int64(len(text)) - encoded; r.Content.Compression != want {
+		t.Errorf("content compression: got %d, want %d", r.Content.Compression, want)
+	}
+}
+
+func TestNewRequestSize(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "http://example.com/upload", strings.NewReader("a=1&b=2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	r, err := NewRequest(req, true)
+	if err != nil {
+		t.Fatalf("NewRequest: %s", err)
+	}
+	header := "POST /upload HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"Content-Length: 7\r\n" +
+		"Content-Type: application/x-www-form-urlencoded\r\n\r\n"
+	if r.HeaderSize != int64(len(header)) {
+		t.Errorf("headerSize: got %d, want %d", r.HeaderSize, len(header))
+	}
+	if r.BodySize != 7 {
+		t.Errorf("bodySize: got %d, want 7", r.BodySize)
+	}
+	if len(r.PostData.Params) != 2 {
+		t.Errorf("params: got %d, want 2", len(r.PostData.Params))
+	}
+}
+
+func TestEntryID(t *testing.T) {
+	h, err := Parse("./testdata/zh.wikipedia.org.har")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := h.Export().Log.Entries
+	ids := make(map[string]struct{})
+	for _, e := range entries {
+		if e.ID == "" {
+			t.Fatalf("entry %s has no id", e.Request.URL)
+		}
+		ids[e.ID] = struct{}{}
+	}
+	if len(ids) != len(entries) {
+		t.Fatalf("ids: got %d unique, want %d", len(ids), len(entries))
+	}
+
+	var (
+		first  = entries[0]
+		second = entries[1]
+		status = second.Response.Status
+	)
+	resp := &http.Response{
+		StatusCode: http.StatusTeapot,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("")),
+	}
+	if err := h.AddResponse(first.ID, resp); err != nil {
+		t.Fatalf("AddResponse: %s", err)
+	}
+	if got := h.Entry(first.ID).Response.Status; got != http.StatusTeapot {
+		t.Errorf("status: got %d, want %d", got, http.StatusTeapot)
+	}
+	if got := h.Entry(second.ID).Response.Status; got != status {
+		t.Errorf("unrelated entry status: got %d, want %d", got, status)
+	}
+
+	err = h.UpdateEntry(second.ID, func(e *Entry) error {
+		e.Comment = "updated"
+		e.ID = "changed"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateEntry: %s", err)
+	}
+	if e := h.Entry(second.ID); e == nil || e.Comment != "updated" {
+		t.Errorf("UpdateEntry: got %+v", e)
+	}
+
+	if err := h.RemoveEntry(first.ID); err != nil {
+		t.Fatalf("RemoveEntry: %s", err)
+	}
+	if h.Entry(first.ID) != nil || h.EntryTotal() != int64(len(entries)-1) {
+		t.Errorf("RemoveEntry: entry still present")
+	}
+	if err := h.RemoveEntry(first.ID); err == nil {
+		t.Error("RemoveEntry: want entry not found error")
+	}
+}
+
+// newReplayHar returns a Har with a GET entry for each path started at the given offsets.
+func newReplayHar(base string, paths []string, offsets []time.Duration) *Har {
+	var (
+		start   = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		entries = make([]*Entry, 0, len(paths))
+	)
+	for i, p := range paths {
+		entries = append(entries, &Entry{
+			StartedDateTime: start.Add(offsets[i]).Format(time.RFC3339Nano),
+			Request:         &Request{Method: http.MethodGet, URL: base + p, HTTPVersion: "HTTP/1.1"},
+			Response:        &Response{},
+			Cache:           &Cache{},
+			Timings:         &Timings{},
+		})
+	}
+	return &Har{Log: &Log{Version: "1.2", Creator: &Creator{Name: "test", Version: "1"}, Entries: entries}}
+}
+
+func TestExecuteOrder(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.URL.Path)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	var (
+		paths   = []string{"/c", "/a", "/d", "/b"}
+		offsets = []time.Duration{3 * time.Second, time.Second, 4 * time.Second, 2 * time.Second}
+	)
+	for _, tc := range []struct {
+		sort bool
+		want []string
+	}{
+		{false, paths},
+		{true, []string{"/a", "/b", "/c", "/d"}},
+	} {
+		seen = nil
+		h, err := NewHandler(newReplayHar(srv.URL, paths, offsets), WithSortByStartedDateTime(tc.sort))
+		if err != nil {
+			t.Fatal(err)
+		}
+		receipts, err := h.Execute(context.TODO(), WithRequestUrlPrefix(srv.URL))
+		if err != nil {
+			t.Fatalf("Execute: %s", err)
+		}
+		var got []string
+		for _, r := range receipts {
+			if r.Error() != nil {
+				t.Fatalf("execute: %s", r.Error())
+			}
+			got = append(got, strings.TrimPrefix(r.Entry.Request.URL, srv.URL))
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("sort=%v receipts: got %v, want %v", tc.sort, got, tc.want)
+		}
+		if strings.Join(seen, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("sort=%v requests: got %v, want %v", tc.sort, seen, tc.want)
+		}
+	}
+}
+
+// multipartBody returns a multipart/form-data body with a field and a file part.
+func multipartBody(t *testing.T) (string, string) {
+	var (
+		buf bytes.Buffer
+		mw  = multipart.NewWriter(&buf)
+	)
+	if err := mw.WriteField("name", "go-har"); err != nil {
+		t.Fatal(err)
+	}
+	fw, err := mw.CreateFormFile("file", "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write([]byte("file content"))
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String(), mw.FormDataContentType()
+}
+
+func TestEntryToRequestRoundTrip(t *testing.T) {
+	form, formType := multipartBody(t)
+	for _, tc := range []struct {
+		name        string
+		method      string
+		url         string
+		contentType string
+		body        string
+	}{
+		{"get", http.MethodGet, "http://example.com/search?q=a+b&q=c&empty=", "", ""},
+		{"json", http.MethodPost, "http://example.com/api?id=1", "application/json", `{"a":1,"b":[true,null]}`},
+		{"text", http.MethodPut, "http://example.com/text", "text/plain; charset=utf-8", "hello go-har"},
+		{"urlencoded", http.MethodPost, "http://example.com/form", "application/x-www-form-urlencoded", "b=2&a=1&a=%26%3D"},
+		{"multipart", http.MethodPost, "http://example.com/upload", formType, form},
+		{"binary", http.MethodPatch, "http://example.com/bin", "application/octet-stream", "\x00\x01\x02"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var body io.Reader
+			if tc.body != "" {
+				body = strings.NewReader(tc.body)
+			}
+			src, err := http.NewRequest(tc.method, tc.url, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.contentType != "" {
+				src.Header.Set("Content-Type", tc.contentType)
+			}
+			src.Header.Set("User-Agent", "go-har")
+			src.Header.Add("Accept", "text/html")
+			src.Header.Add("Accept", "application/json")
+			src.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+			src.AddCookie(&http.Cookie{Name: "lang", Value: "en"})
+
+			req, err := NewRequest(src, true)
+			if err != nil {
+				t.Fatalf("NewRequest: %s", err)
+			}
+			got, err := EntryToRequest(&Entry{Request: req}, true)
+			if err != nil {
+				t.Fatalf("EntryToRequest: %s", err)
+			}
+
+			if got.Method != tc.method {
+				t.Errorf("method: got %s, want %s", got.Method, tc.method)
+			}
+			if got.URL.String() != tc.url {
+				t.Errorf("url: got %s, want %s", got.URL, tc.url)
+			}
+			for _, name := range []string{"Content-Type", "User-Agent", "Accept"} {
+				if g, w := got.Header.Values(name), src.Header.Values(name); strings.Join(g, ",") != strings.Join(w, ",") {
+					t.Errorf("header %s: got %q, want %q", name, g, w)
+				}
+			}
+			var gc []string
+			for _, c := range got.Cookies() {
+				gc = append(gc, c.String())
+			}
+			if strings.Join(gc, "; ") != "session=abc; lang=en" {
+				t.Errorf("cookies: got %q", gc)
+			}
+			b, err := io.ReadAll(got.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tc.body {
+				t.Errorf("body: got %q, want %q", b, tc.body)
+			}
+			if got.ContentLength != int64(len(tc.body)) {
+				t.Errorf("content length: got %d, want %d", got.ContentLength, len(tc.body))
+			}
+		})
+	}
+}
+
+func TestEntryToRequestHeaders(t *testing.T) {
+	e := &Entry{Request: &Request{
+		Method:      http.MethodPost,
+		URL:         "https://example.com/path",
+		HTTPVersion: "HTTP/2.0",
+		Headers: []*NVP{
+			{Name: ":method", Value: "POST"},
+			{Name: ":authority", Value: "api.example.com"},
+			{Name: ":path", Value: "/path"},
+			{Name: "content-length", Value: "999"},
+			{Name: "content-encoding", Value: "gzip"},
+			{Name: "cookie", Value: "a=1"},
+			{Name: "x-trace", Value: "1"},
+		},
+		QueryString: []*NVP{{Name: "k", Value: "v w"}},
+		PostData:    &PostData{MimeType: "application/x-www-form-urlencoded", Params: []*PostParam{{Name: "a", Value: "1&2"}}},
+	}}
+
+	req, err := EntryToRequest(e, false)
+	if err != nil {
+		t.Fatalf("EntryToRequest: %s", err)
+	}
+	if req.Host != "api.example.com" {
+		t.Errorf("host: got %s", req.Host)
+	}
+	if req.URL.RawQuery != "k=v+w" {
+		t.Errorf("query: got %s", req.URL.RawQuery)
+	}
+	for _, name := range []string{":method", ":path", "Content-Length", "Content-Encoding", "Cookie"} {
+		if v := req.Header.Get(name); v != "" {
+			t.Errorf("header %s: got %q, want none", name, v)
+		}
+	}
+	if v := req.Header.Get("X-Trace"); v != "1" {
+		t.Errorf("header X-Trace: got %q", v)
+	}
+	b, _ := io.ReadAll(req.Body)
+	if string(b) != "a=1%262" || req.ContentLength != int64(len(b)) {
+		t.Errorf("body: got %q length %d", b, req.ContentLength)
+	}
+
+	req, err = EntryToRequest(e, true)
+	if err != nil {
+		t.Fatalf("EntryToRequest: %s", err)
+	}
+	if v := req.Header.Get("Cookie"); v != "a=1" {
+		t.Errorf("cookie: got %q, want a=1", v)
+	}
+}
+
+func TestExecuteUpload(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		files = make(map[string]string)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		files["name"] = r.FormValue("name")
+		for field, fhs := range r.MultipartForm.File {
+			f, err := fhs[0].Open()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			b, _ := io.ReadAll(f)
+			_ = f.Close()
+			files[field] = fhs[0].Filename + ":" + string(b)
+		}
+	}))
+	defer srv.Close()
+
+	var (
+		dir  = t.TempDir()
+		doc  = dir + "/doc.pdf"
+		har  = newReplayHar(srv.URL, []string{"/upload"}, []time.Duration{0})
+		post = har.Log.Entries[0].Request
+	)
+	if err := os.WriteFile(doc, []byte("local doc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	post.Method = http.MethodPost
+	post.Headers = []*NVP{{Name: "Content-Type", Value: "multipart/form-data; boundary=go-har-boundary"}}
+	post.PostData = &PostData{
+		MimeType: "multipart/form-data; boundary=go-har-boundary",
+		Params: []*PostParam{
+			{Name: "name", Value: "go-har"},
+			{Name: "image", Value: "recorded image", FileName: `C:\Users\me\a.png`, ContentType: "image/png"},
+			{Name: "doc", Value: "recorded doc", FileName: "doc.pdf"},
+			{Name: "other", Value: "recorded other", FileName: "missing.txt"},
+		},
+	}
+
+	h, err := NewHandler(har,
+		WithUploadFS(fstest.MapFS{"a.png": {Data: []byte("fs image")}}),
+		WithUploadFile("doc", doc),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipts, err := h.Execute(context.TODO())
+	if err != nil {
+		t.Fatalf("Execute: %s", err)
+	}
+	if r := receipts[0]; r.Error() != nil || r.Response.StatusCode != http.StatusOK {
+		t.Fatalf("execute: %v %s", r.Error(), r.Body())
+	}
+	want := map[string]string{
+		"name":  "go-har",
+		"image": `C:\Users\me\a.png:fs image`,
+		"doc":   "doc.pdf:local doc",
+		"other": "missing.txt:recorded other",
+	}
+	for k, v := range want {
+		if files[k] != v {
+			t.Errorf("%s: got %q, want %q", k, files[k], v)
+		}
+	}
+}
+
+func TestSyncExecuteCancel(t *testing.T) {
+	var started = make(chan struct{}, 3)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	var (
+		paths   = []string{"/a", "/b", "/c"}
+		offsets = []time.Duration{0, 0, 0}
+	)
+	h, err := NewHandler(newReplayHar(srv.URL, paths, offsets), WithRequestConcurrency(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	receipt, err := h.SyncExecute(ctx)
+	if err != nil {
+		t.Fatalf("SyncExecute: %s", err)
+	}
+	<-started
+	cancel()
+
+	var n int
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case r, ok := <-receipt:
+			if !ok {
+				if n != len(paths) {
+					t.Errorf("receipts: got %d, want %d", n, len(paths))
+				}
+				if len(started) != 0 {
+					t.Errorf("requests sent after cancel: %d", len(started))
+				}
+				return
+			}
+			n++
+			if !errors.Is(r.Error(), context.Canceled) {
+				t.Errorf("%s: got %v, want context.Canceled", r.Entry.Request.URL, r.Error())
+			}
+		case <-timeout:
+			t.Fatal("receipt channel not closed after cancel")
+		}
+	}
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}))
+	defer srv.Close()
+
+	har := newReplayHar(srv.URL, []string{"/slow", "/fast"}, []time.Duration{0, time.Second})
+	h, err := NewHandler(har, WithRequestTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipts, err := h.Execute(context.TODO())
+	if err != nil {
+		t.Fatalf("Execute: %s", err)
+	}
+	if err := receipts[0].Error(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow: got %v, want context.DeadlineExceeded", err)
+	}
+	if err := receipts[1].Error(); err != nil {
+		t.Errorf("fast: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	receipts, err = h.Execute(ctx)
+	if err != nil {
+		t.Fatalf("Execute: %s", err)
+	}
+	for _, r := range receipts {
+		if !errors.Is(r.Error(), context.Canceled) || r.Response != nil {
+			t.Errorf("%s: got %v, want context.Canceled", r.Entry.Request.URL, r.Error())
+		}
+	}
+}
+
+func TestExecuteResponseStream(t *testing.T) {
+	var text = strings.Repeat("0123456789", 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, text)
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name     string
+		opts     []Option
+		body     int // bytes of Response.Body
+		captured int // bytes of Receipt.Body
+		filled   bool
+		err      error
+	}{
+		{"buffered", nil, len(text), len(text), true, nil},
+		{"buffered capped", []Option{WithMaxBodyCapture(100)}, 100, 100, false, ErrBodyTruncated},
+		{"stream", []Option{WithResponseStream(true)}, len(text), len(text), true, nil},
+		{"stream capped", []Option{WithResponseStream(true), WithMaxBodyCapture(100)}, len(text), 100, false, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := NewHandler(newReplayHar(srv.URL, []string{"/"}, []time.Duration{0}), tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			receipts, err := h.Execute(context.TODO())
+			if err != nil {
+				t.Fatalf("Execute: %s", err)
+			}
+			r := receipts[0]
+			if !errors.Is(r.Error(), tc.err) || (tc.err == nil && r.Error() != nil) {
+				t.Fatalf("execute: got %v, want %v", r.Error(), tc.err)
+			}
+			b, err := io.ReadAll(r.Response.Body)
+			_ = r.Response.Body.Close()
+			if err != nil {
+				t.Fatalf("read body: %s", err)
+			}
+			if len(b) != tc.body {
+				t.Errorf("response body: got %d bytes, want %d", len(b), tc.body)
+			}
+			if got := len(r.Body()); got != tc.captured {
+				t.Errorf("captured body: got %d bytes, want %d", got, tc.captured)
+			}
+
+			if err := r.FillInResponse(true); err != nil {
+				t.Fatalf("FillInResponse: %s", err)
+			}
+			content := r.Entry.Response.Content
+			if filled := string(content.Text) == text; filled != tc.filled {
+				t.Errorf("content text: got %d bytes, filled %v want %v", len(content.Text), filled, tc.filled)
+			}
+			if !tc.filled && (content.Comment == "" || r.Entry.Response.BodySize != int64(len(text))) {
+				t.Errorf("truncated content: comment %q bodySize %d", content.Comment, r.Entry.Response.BodySize)
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var (
+		inflight atomic.Int64
+		block    = make(chan struct{})
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inflight.Add(1)
+		defer inflight.Add(-1)
+		if r.URL.Path != "/a" {
+			select {
+			case <-r.Context().Done():
+			case <-block:
+			}
+		}
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	var (
+		paths   = []string{"/a", "/b", "/c", "/d"}
+		offsets = []time.Duration{0, 0, 0, 0}
+	)
+	h, err := NewHandler(newReplayHar(srv.URL, paths, offsets), WithRequestConcurrency(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for r, err := range h.Replay(context.TODO(), WithRequestUrlIs(srv.URL+"/a", srv.URL+"/b")) {
+		got = append(got, strings.TrimPrefix(r.Entry.Request.URL, srv.URL))
+		if err != nil {
+			t.Fatalf("replay: %s", err)
+		}
+		break
+	}
+	if strings.Join(got, ",") != "/a" {
+		t.Errorf("Replay: got %v, want [/a]", got)
+	}
+
+	got = nil
+	for r, err := range h.SyncReplay(context.TODO()) {
+		got = append(got, strings.TrimPrefix(r.Entry.Request.URL, srv.URL))
+		if err != nil {
+			t.Fatalf("replay: %s", err)
+		}
+		break
+	}
+	if strings.Join(got, ",") != "/a" {
+		t.Errorf("SyncReplay: got %v, want [/a]", got)
+	}
+	// the requests in flight are canceled when the loop is left
+	for i := 0; inflight.Load() != 0; i++ {
+		if i == 100 {
+			t.Fatalf("requests in flight after break: %d", inflight.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestExecuteCookieJar(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "fresh", Path: "/"})
+			return
+		}
+		var values []string
+		for _, name := range []string{"session", "lang"} {
+			if c, err := r.Cookie(name); err == nil {
+				values = append(values, c.String())
+			}
+		}
+		_, _ = io.WriteString(w, strings.Join(values, "; "))
+	}))
+	defer srv.Close()
+
+	var (
+		har     = newReplayHar(srv.URL, []string{"/login", "/api/me"}, []time.Duration{0, time.Second})
+		me      = har.Log.Entries[1].Request
+		jar, _  = cookiejar.New(nil)
+		expired = time.Now().Add(-time.Hour).UTC().Format(time.RFC3339Nano)
+	)
+	me.Cookies = []*Cookie{{Name: "session", Value: "recorded"}, {Name: "lang", Value: "en", Expires: expired}}
+	me.Headers = []*NVP{{Name: "Cookie", Value: "session=recorded; lang=en"}}
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{"recorded", nil, "session=recorded; lang=en"},
+		{"no cookie", []Option{WithCookie(false)}, ""},
+		{"jar", []Option{WithCookieJar(jar)}, "session=fresh; lang=en"},
+	} {
+		h, err := NewHandler(har, tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		receipt, err := h.SyncExecute(context.TODO(), WithRequestUrlIs(srv.URL+"/login"))
+		if err != nil {
+			t.Fatalf("SyncExecute: %s", err)
+		}
+		for r := range receipt {
+			if r.Error() != nil {
+				t.Fatalf("%s: login: %s", tc.name, r.Error())
+			}
+		}
+		for r, err := range h.Replay(context.TODO(), WithRequestUrlIs(srv.URL+"/api/me")) {
+			if err != nil {
+				t.Fatalf("%s: me: %s", tc.name, err)
+			}
+			got = append(got, string(r.Body()))
+		}
+		if strings.Join(got, ",") != tc.want {
+			t.Errorf("%s: cookies: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
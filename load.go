@@ -0,0 +1,266 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"maps"
+	"math"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// LoadConfig configures the load test run by Handler.Load.
+type LoadConfig struct {
+	// Users is the number of virtual users replaying the entries concurrently,
+	// 1 by default.
+	Users int
+	// RampUp is the time over which the users are started evenly.
+	RampUp time.Duration
+	// Duration is the time the users replay the entries in loop, the requests
+	// in flight at the end are canceled and left out of the result.
+	Duration time.Duration
+	// Iterations is the number of times each user replays the entries when
+	// Duration is 0, 1 by default.
+	Iterations int
+	// Session whether each user replays the entries with its own cookie jar,
+	// see WithCookieJar.
+	Session bool
+	// Group returns the name of the statistics an entry is accounted in, its
+	// method and url without query by default.
+	Group func(e *Entry) string
+}
+
+// LoadStats are the statistics of the requests of a load test.
+type LoadStats struct {
+	Name     string `json:"name"`
+	Requests int    `json:"requests"`
+	// Errors counts the requests failing or answered with a status >= 400,
+	// ErrBodyTruncated is not a failure.
+	Errors     int     `json:"errors"`
+	ErrorRate  float64 `json:"errorRate"`
+	Throughput float64 `json:"throughput"` // requests per second
+	// Latencies of the last attempt of the requests, response body included,
+	// the waits of the rate limits and the retry backoffs are left out.
+	// The percentiles are estimated within 1% in a constant memory.
+	Min  time.Duration `json:"min"`
+	Mean time.Duration `json:"mean"`
+	P50  time.Duration `json:"p50"`
+	P90  time.Duration `json:"p90"`
+	P95  time.Duration `json:"p95"`
+	P99  time.Duration `json:"p99"`
+	Max  time.Duration `json:"max"`
+
+	sum       time.Duration
+	latencies histogram
+}
+
+// LoadResult is the result of a load test.
+type LoadResult struct {
+	Duration time.Duration `json:"duration"`
+	Total    *LoadStats    `json:"total"`
+	// Groups are the statistics of each group of entries sorted by name, see
+	// LoadConfig.Group.
+	Groups []*LoadStats `json:"groups"`
+}
+
+// Load runs a load test replaying the entries matching all the filters: each
+// virtual user replays them in sequence like Execute, for a number of
+// iterations or a duration. The options of the Handler apply to every request,
+// e.g. WithRetry or WithRateLimit, WithMaxBodyCapture bounds the memory used
+// by the response bodies. If ctx is done, the result of the requests completed
+// so far is returned with the error of ctx.
+func (h *Handler) Load(ctx context.Context, cfg LoadConfig, filter ...RequestOption) (*LoadResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var (
+		entries = h.selectEntries(filter...)
+		users   = max(cfg.Users, 1)
+		group   = cfg.Group
+		runCtx  = ctx
+		cancel  = context.CancelFunc(func() {})
+	)
+	if group == nil {
+		group = defaultGroup
+	}
+	if cfg.Duration > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, cfg.Duration)
+	}
+	defer cancel()
+
+	var (
+		mu     sync.Mutex
+		total  = &LoadStats{Name: "total"}
+		groups = make(map[string]*LoadStats)
+		wg     sync.WaitGroup
+		start  = time.Now()
+	)
+	var record = func(e *Entry, r *Receipt, latency time.Duration) {
+		// a body over WithMaxBodyCapture was received all the same
+		var failed = (r.err != nil && !errors.Is(r.err, ErrBodyTruncated)) ||
+			r.Response == nil || r.Response.StatusCode >= http.StatusBadRequest
+		mu.Lock()
+		defer mu.Unlock()
+		var name = group(e)
+		if groups[name] == nil {
+			groups[name] = &LoadStats{Name: name}
+		}
+		for _, s := range []*LoadStats{total, groups[name]} {
+			s.Requests++
+			if failed {
+				s.Errors++
+			}
+			s.observe(latency)
+		}
+	}
+
+	for i := range users {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cfg.RampUp > 0 && !sleep(runCtx, cfg.RampUp*time.Duration(i)/time.Duration(users)) {
+				return
+			}
+			var client = h.client()
+			if cfg.Session {
+				client.Jar, _ = cookiejar.New(nil)
+			}
+			for n := 0; cfg.Duration > 0 || n < max(cfg.Iterations, 1); n++ {
+				for _, e := range entries {
+					r := h.replay(runCtx, client, e, h.cookie)
+					r.discard()
+					// the requests canceled at the end of the run are not accounted
+					if runCtx.Err() != nil && (errors.Is(r.err, context.Canceled) || errors.Is(r.err, context.DeadlineExceeded)) {
+						return
+					}
+					record(e, &r, latency(&r))
+				}
+				if len(entries) == 0 || runCtx.Err() != nil {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var result = &LoadResult{Duration: time.Since(start), Total: total}
+	total.compute(result.Duration)
+	for _, s := range groups {
+		s.compute(result.Duration)
+		result.Groups = append(result.Groups, s)
+	}
+	slices.SortFunc(result.Groups, func(a, b *LoadStats) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return result, ctx.Err()
+}
+
+// latency returns the time of the last attempt of r.
+func latency(r *Receipt) time.Duration {
+	var t = r.Timings()
+	if t == nil {
+		return 0
+	}
+	return time.Duration(t.total() * float64(time.Millisecond))
+}
+
+// defaultGroup groups the entries by method and url without query.
+func defaultGroup(e *Entry) string {
+	u, err := url.Parse(e.Request.URL)
+	if err != nil {
+		return e.Request.Method + " " + e.Request.URL
+	}
+	u.RawQuery, u.Fragment = "", ""
+	return e.Request.Method + " " + u.String()
+}
+
+// compute sets the rates and the latency percentiles of s over elapsed.
+func (s *LoadStats) compute(elapsed time.Duration) {
+	if s.Requests == 0 {
+		return
+	}
+	s.ErrorRate = float64(s.Errors) / float64(s.Requests)
+	if elapsed > 0 {
+		s.Throughput = float64(s.Requests) / elapsed.Seconds()
+	}
+
+	s.Mean = s.sum / time.Duration(s.Requests)
+	s.P50 = s.percentile(50)
+	s.P90 = s.percentile(90)
+	s.P95 = s.percentile(95)
+	s.P99 = s.percentile(99)
+	s.latencies = histogram{}
+}
+
+// observe accounts the latency of a request in s.
+func (s *LoadStats) observe(d time.Duration) {
+	if s.latencies.n == 0 || d < s.Min {
+		s.Min = d
+	}
+	s.Max = max(s.Max, d)
+	s.sum += d
+	s.latencies.add(d)
+}
+
+// percentile returns the percentile p of the latencies, within Min and Max.
+func (s *LoadStats) percentile(p float64) time.Duration {
+	return min(max(s.latencies.percentile(p), s.Min), s.Max)
+}
+
+// histogramGrowth is the log of the ratio between the bounds of a bucket of
+// histogram, a value is 1% at most from the middle of its bucket.
+var histogramGrowth = math.Log1p(0.02)
+
+// histogram counts durations in buckets growing exponentially, less than
+// 2000 buckets cover durations from 1ns to a day.
+type histogram struct {
+	counts map[int]int
+	n      int
+}
+
+func (h *histogram) add(d time.Duration) {
+	if h.counts == nil {
+		h.counts = make(map[int]int)
+	}
+	h.counts[int(math.Log(max(float64(d), 1))/histogramGrowth)]++
+	h.n++
+}
+
+// percentile returns the middle of the bucket of the nearest-rank percentile p.
+func (h *histogram) percentile(p float64) time.Duration {
+	var rank = max(int(math.Ceil(p/100*float64(h.n))), 1)
+	for _, b := range slices.Sorted(maps.Keys(h.counts)) {
+		if rank -= h.counts[b]; rank <= 0 {
+			return time.Duration(math.Exp((float64(b) + 0.5) * histogramGrowth))
+		}
+	}
+	return 0
+}
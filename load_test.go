@@ -0,0 +1,149 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "1", Path: "/"})
+		case "/me":
+			if _, err := r.Cookie("session"); err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	har := newReplayHar(srv.URL, []string{"/login", "/me?a=1", "/me?a=2", "/fail"}, []time.Duration{0, 0, 0, 0})
+	h, err := NewHandler(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := h.Load(context.TODO(), LoadConfig{Users: 4, Iterations: 3, Session: true, RampUp: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	if result.Total.Requests != 48 || result.Total.Errors != 12 || result.Total.ErrorRate != 0.25 {
+		t.Errorf("total: %+v", result.Total)
+	}
+	want := map[string][2]int{
+		"GET " + srv.URL + "/fail":  {12, 12},
+		"GET " + srv.URL + "/login": {12, 0},
+		"GET " + srv.URL + "/me":    {24, 0},
+	}
+	if len(result.Groups) != len(want) {
+		t.Fatalf("groups: got %d, want %d", len(result.Groups), len(want))
+	}
+	for _, g := range result.Groups {
+		if w := want[g.Name]; g.Requests != w[0] || g.Errors != w[1] {
+			t.Errorf("%s: got %d requests %d errors, want %v", g.Name, g.Requests, g.Errors, w)
+		}
+		if g.Min > g.P50 || g.P50 > g.P99 || g.P99 > g.Max || g.Throughput <= 0 {
+			t.Errorf("%s: stats %+v", g.Name, g)
+		}
+	}
+
+	// without session the cookie set by /login is not sent
+	result, err = h.Load(context.TODO(), LoadConfig{Users: 2}, WithRequestUrlRegexp(regexp.MustCompile(`/me`)))
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	if result.Total.Requests != 4 || result.Total.Errors != 4 {
+		t.Errorf("no session: %+v", result.Total)
+	}
+
+	start := time.Now()
+	result, err = h.Load(context.TODO(), LoadConfig{Users: 2, Duration: 100 * time.Millisecond}, WithRequestUrlIs(srv.URL+"/login"))
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("duration: %s", elapsed)
+	}
+	if result.Total.Requests == 0 || result.Total.Errors != 0 {
+		t.Errorf("duration: %+v", result.Total)
+	}
+}
+
+func TestLoadRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	h, err := NewHandler(newReplayHar(srv.URL, []string{"/"}, []time.Duration{0}), WithRateLimit(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	result, err := h.Load(context.TODO(), LoadConfig{Users: 4, Iterations: 2})
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("elapsed: got %s, want the rate limit to space out 8 requests", elapsed)
+	}
+	// the waits of the rate limit are not latency of the server
+	if s := result.Total; s.Requests != 8 || s.P50 >= 25*time.Millisecond {
+		t.Errorf("stats: %+v", s)
+	}
+}
+
+func TestLoadStatsPercentiles(t *testing.T) {
+	var s = &LoadStats{Name: "total"}
+	for i := 1; i <= 100000; i++ {
+		s.Requests++
+		s.observe(time.Duration(i) * time.Microsecond)
+	}
+	if n := len(s.latencies.counts); n > 1000 {
+		t.Errorf("buckets: got %d", n)
+	}
+	s.compute(time.Second)
+	if s.Min != time.Microsecond || s.Max != 100*time.Millisecond {
+		t.Errorf("min %s max %s", s.Min, s.Max)
+	}
+	for _, tc := range []struct {
+		got, want time.Duration
+	}{
+		{s.P50, 50 * time.Millisecond},
+		{s.P90, 90 * time.Millisecond},
+		{s.P99, 99 * time.Millisecond},
+		{s.Mean, 50*time.Millisecond + 500*time.Nanosecond},
+	} {
+		if d := tc.got - tc.want; d < -tc.want/100 || d > tc.want/100 {
+			t.Errorf("got %s, want %s within 1%%", tc.got, tc.want)
+		}
+	}
+}
@@ -38,6 +38,7 @@ type MessageView struct {
 	compress      string
 	bodyoffset    int64
 	traileroffset int64
+	encodedsize   int64
 }
 
 type config struct {
@@ -116,6 +117,7 @@ func (mv *MessageView) SnapshotRequest(req *http.Request) error {
 	if err != nil {
 		return err
 	}
+	mv.encodedsize = int64(len(data))
 	req.Body.Close()
 
 	if mv.chunked {
@@ -182,6 +184,7 @@ func (mv *MessageView) SnapshotResponse(res *http.Response) error {
 	if err != nil {
 		return err
 	}
+	mv.encodedsize = int64(len(data))
 	res.Body.Close()
 
 	if mv.chunked {
@@ -205,6 +208,24 @@ func (mv *MessageView) SnapshotResponse(res *http.Response) error {
 	return nil
 }
 
+// HeaderSize returns the number of bytes from the start of the message until
+// (and including) the double CRLF before the body.
+func (mv *MessageView) HeaderSize() int64 {
+	return mv.bodyoffset
+}
+
+// BodySize returns the number of bytes of the body as sent on the wire, that
+// is still chunked and compressed. It returns zero if the body was skipped.
+func (mv *MessageView) BodySize() int64 {
+	return mv.traileroffset - mv.bodyoffset
+}
+
+// EncodedBodySize returns the number of bytes of the body without the chunked
+// transfer coding, that is still compressed. It returns zero if the body was skipped.
+func (mv *MessageView) EncodedBodySize() int64 {
+	return mv.encodedsize
+}
+
 // Reader returns the an io.ReadCloser that reads the full HTTP message.
 func (mv *MessageView) Reader(opts ...Option) (io.ReadCloser, error) {
 	hr := mv.HeaderReader()
@@ -523,6 +523,13 @@ func TestResponseView(t *testing.T) {
 		t.Fatalf("mv.Read(): got %q, want %q", got, want)
 	}
 
+	if got, want := mv.HeaderSize(), int64(len(hdrwant)); got != want {
+		t.Errorf("mv.HeaderSize(): got %d, want %d", got, want)
+	}
+	if got, want := mv.BodySize(), int64(len(bodywant)); got != want {
+		t.Errorf("mv.BodySize(): got %d, want %d", got, want)
+	}
+
 	// Sanity check to ensure it still parses.
 	if _, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(got)), nil); err != nil {
 		t.Fatalf("http.ReadResponse(): got %v, want no error", err)
@@ -637,6 +644,13 @@ func TestResponseViewChunkedTransferEncoding(t *testing.T) {
 		t.Fatalf("mv.Read(): got %q, want %q", got, want)
 	}
 
+	if got, want := mv.BodySize(), int64(len(bodywant)); got != want {
+		t.Errorf("mv.BodySize(): got %d, want %d", got, want)
+	}
+	if got, want := mv.EncodedBodySize(), int64(len("body content")); got != want {
+		t.Errorf("mv.EncodedBodySize(): got %d, want %d", got, want)
+	}
+
 	// Sanity check to ensure it still parses.
 	if _, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(got)), nil); err != nil {
 		t.Fatalf("http.ReadResponse(): got %v, want no error", err)
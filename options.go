@@ -24,9 +24,16 @@
 package go_har
 
 import (
+	"io"
+	"io/fs"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 )
 
 // Option represents the optional function
@@ -114,6 +121,20 @@ func WithSkipResponseBodyForContentTypes(cts ...string) Option {
 	}
 }
 
+// defaultRecordBodyLimit is the default of WithRecordBodyLimit.
+const defaultRecordBodyLimit = 10 << 20
+
+// WithRecordBodyLimit limits the bytes of each request and response body kept
+// in memory by Middleware and of each response body kept by RoundTripper,
+// 10MiB by default. 0 indicates no limit.
+// A truncated request body is recorded as raw text, a truncated response body
+// is left out, both with a comment.
+func WithRecordBodyLimit(n int64) Option {
+	return func(h *Handler) {
+		h.recordLimit = n
+	}
+}
+
 // WithComment .
 func WithComment(str string) Option {
 	return func(h *Handler) {
@@ -121,13 +142,85 @@ func WithComment(str string) Option {
 	}
 }
 
-// WithCookie whether http requests carry cookies
+// WithCookie whether replayed http requests carry the recorded cookies,
+// see WithCookieJar to replay a session.
 func WithCookie(c bool) Option {
 	return func(h *Handler) {
 		h.cookie = c
 	}
 }
 
+// WithCookieJar replays the entries as a session sharing jar: the recorded
+// cookies of each request seed the jar unless it has a cookie of the same name
+// already, and the cookies set by the replayed responses update it, so that
+// e.g. the session token of a replayed login is sent by the following requests.
+// The recorded cookies are then not copied onto the requests, see WithCookie.
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(h *Handler) {
+		h.jar = jar
+	}
+}
+
+// WithStrictValidation whether the Har given to NewHandler, NewReader or Parse is
+// validated strictly against the Har 1.2 specification, see Har.Validate.
+func WithStrictValidation(strict bool) Option {
+	return func(h *Handler) {
+		h.strict = strict
+	}
+}
+
+// WithStreamWriter writes the entries recorded by RoundTripper, Middleware and
+// AddResponse to sw as soon as they are complete, instead of keeping them in memory.
+func WithStreamWriter(sw *StreamWriter) Option {
+	return func(h *Handler) {
+		h.stream = sw
+	}
+}
+
+// WithSortByStartedDateTime whether Execute and SyncExecute replay entries sorted by
+// their startedDateTime rather than in the order of the Har, for unsorted files.
+func WithSortByStartedDateTime(enabled bool) Option {
+	return func(h *Handler) {
+		h.sortByTime = enabled
+	}
+}
+
+// WithUploadFS replays the file parts of multipart/form-data requests with the
+// content of the file of fsys named after the base of the recorded file name,
+// instead of the recorded content. The parts whose file does not exist are
+// replayed as recorded. Sources of several upload options are looked up in order.
+func WithUploadFS(fsys fs.FS) Option {
+	return func(h *Handler) {
+		h.uploads = append(h.uploads, func(p *PostParam) (io.ReadCloser, error) {
+			return fsys.Open(uploadName(p.FileName))
+		})
+	}
+}
+
+// WithUploadDir is WithUploadFS with the files of the local directory dir.
+func WithUploadDir(dir string) Option {
+	return WithUploadFS(os.DirFS(dir))
+}
+
+// WithUploadFile replays the file parts of the form field name with the content
+// of the local file filename, whatever the recorded file name.
+func WithUploadFile(name, filename string) Option {
+	return func(h *Handler) {
+		h.uploads = append(h.uploads, func(p *PostParam) (io.ReadCloser, error) {
+			if p.Name != name {
+				return nil, nil
+			}
+			return os.Open(filename)
+		})
+	}
+}
+
+// uploadName returns the base of the recorded file name, some browsers record
+// the full client path of the file.
+func uploadName(name string) string {
+	return path.Base(strings.ReplaceAll(name, "\\", "/"))
+}
+
 // WithTransport set http.RoundTripper
 func WithTransport(t http.RoundTripper) Option {
 	return func(h *Handler) {
@@ -142,6 +235,70 @@ func WithRequestConcurrency(num uint64) Option {
 	}
 }
 
+// WithRequestTimeout limits the time of each replayed request, reading its
+// response body included. 0 indicates no limit.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(h *Handler) {
+		h.timeout = d
+	}
+}
+
+// WithRetry sends replayed requests again after a failure according to p,
+// the attempts are reported by Receipt.Attempts and Receipt.AttemptErrors.
+func WithRetry(p RetryPolicy) Option {
+	return func(h *Handler) {
+		p.StatusCodes = slices.Clone(p.StatusCodes)
+		h.retry = p
+	}
+}
+
+// WithRateLimit limits the replayed requests to rps requests per second
+// across all the replays of the Handler, retries included. 0 indicates no limit.
+func WithRateLimit(rps float64) Option {
+	return func(h *Handler) {
+		h.limit = newLimiter(rps)
+	}
+}
+
+// WithHostRateLimit limits the replayed requests to rps requests per second
+// for each host, in addition to WithRateLimit. 0 indicates no limit.
+func WithHostRateLimit(rps float64) Option {
+	return func(h *Handler) {
+		h.hostLimit = newHostLimiter(rps)
+	}
+}
+
+// WithFaithfulTiming replays the entries with the gaps between their
+// startedDateTime, divided by speed: 1 reproduces the recorded traffic, 2
+// replays it twice as fast. Entries are still limited by the concurrency and
+// the rate limits, and an entry recorded before the previous one in the replay
+// order is sent at once, see WithSortByStartedDateTime. 0 disables it.
+func WithFaithfulTiming(speed float64) Option {
+	return func(h *Handler) {
+		h.speed = speed
+	}
+}
+
+// WithResponseStream whether Execute and SyncExecute hand Receipt.Response.Body
+// over as it is received instead of reading it in memory first. The caller must
+// then read and close the body, Receipt.Body is captured as it is read.
+func WithResponseStream(enabled bool) Option {
+	return func(h *Handler) {
+		h.streamBody = enabled
+	}
+}
+
+// WithMaxBodyCapture limits the bytes of each replayed response body kept in
+// memory for Receipt.Body and Receipt.FillInResponse, 0 indicates no limit.
+// Without WithResponseStream the rest of the body is discarded, so
+// Receipt.Response.Body is truncated as well and the receipt holds
+// ErrBodyTruncated, use WithResponseStream to read large bodies entirely.
+func WithMaxBodyCapture(n int64) Option {
+	return func(h *Handler) {
+		h.maxBody = n
+	}
+}
+
 // WithLogger Register a logger object interface
 func WithLogger(l Logger) Option {
 	return func(ctx *Handler) {
@@ -149,10 +306,42 @@ func WithLogger(l Logger) Option {
 	}
 }
 
-// RequestOption SyncExecute() or Execute() represents the optional function
-// TODO: The current condition is a OR condition, which needs to be changed into an AND policy
+// RequestOption SyncExecute() or Execute() represents the optional function.
+// An entry is selected when it matches all the given options, use All, Any and
+// Not to compose them.
 type RequestOption func(ctx *Handler, e *Entry) bool
 
+// All selects the entries matching every option, All() matches any entry.
+func All(opts ...RequestOption) RequestOption {
+	return func(ctx *Handler, e *Entry) bool {
+		for _, opt := range opts {
+			if !opt(ctx, e) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Any selects the entries matching at least one option, Any() matches no entry.
+func Any(opts ...RequestOption) RequestOption {
+	return func(ctx *Handler, e *Entry) bool {
+		for _, opt := range opts {
+			if opt(ctx, e) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not selects the entries not matching opt.
+func Not(opt RequestOption) RequestOption {
+	return func(ctx *Handler, e *Entry) bool {
+		return !opt(ctx, e)
+	}
+}
+
 // WithRequestUrlIs .
 func WithRequestUrlIs(urls ...string) RequestOption {
 	var urlSet = make(map[string]struct{}, len(urls))
@@ -182,23 +371,34 @@ func WithRequestUrlRegexp(regexps *regexp.Regexp) RequestOption {
 	}
 }
 
-// WithRequestHostIs .
+// WithRequestHostIs selects the entries whose url host, with or without port, is one of hosts.
 func WithRequestHostIs(hosts ...string) RequestOption {
 	var hostSet = make(map[string]struct{}, len(hosts))
 	for _, u := range hosts {
-		hostSet[u] = struct{}{}
+		hostSet[strings.ToLower(u)] = struct{}{}
 	}
 	return func(ctx *Handler, e *Entry) bool {
-		_, ok := hostSet[e.Request.URL]
+		u, err := url.Parse(e.Request.URL)
+		if err != nil {
+			return false
+		}
+		if _, ok := hostSet[strings.ToLower(u.Host)]; ok {
+			return true
+		}
+		_, ok := hostSet[strings.ToLower(u.Hostname())]
 		return ok
 	}
 }
 
-// WithRequestHostRegexp .
+// WithRequestHostRegexp selects the entries whose url host matches one of regexps.
 func WithRequestHostRegexp(regexps ...*regexp.Regexp) RequestOption {
 	return func(ctx *Handler, e *Entry) bool {
+		u, err := url.Parse(e.Request.URL)
+		if err != nil {
+			return false
+		}
 		for _, r := range regexps {
-			if r.MatchString(e.Request.URL) {
+			if r.MatchString(u.Host) {
 				return true
 			}
 		}
@@ -220,13 +420,30 @@ func WithRequestMethod(methods ...string) RequestOption {
 
 // WithSkipRequestMethod .
 func WithSkipRequestMethod(methods ...string) RequestOption {
+	return Not(WithRequestMethod(methods...))
+}
+
+// WithEntryID selects the entries with one of the given ids.
+func WithEntryID(ids ...string) RequestOption {
+	var idSet = make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		idSet[id] = struct{}{}
+	}
 	return func(ctx *Handler, e *Entry) bool {
-		for _, r := range methods {
-			if e.Request.Method != strings.ToUpper(r) {
-				return false
-			}
-		}
-		return true
+		_, ok := idSet[e.ID]
+		return ok
+	}
+}
+
+// WithPageRef selects the entries referring to one of the given pages.
+func WithPageRef(ids ...string) RequestOption {
+	var pageSet = make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		pageSet[id] = struct{}{}
+	}
+	return func(ctx *Handler, e *Entry) bool {
+		_, ok := pageSet[e.PageRef]
+		return ok
 	}
 }
 
@@ -237,24 +454,116 @@ func WithRequestHandler(handler EntityHandler) RequestOption {
 	}
 }
 
-// // WithResponseStatusCode .
-// func WithResponseStatusCode(codes ...int) RequestOption {
-// 	var codeSet = make(map[int]struct{}, len(codes))
-// 	for _, c := range codes {
-// 		codeSet[c] = struct{}{}
-// 	}
-// 	return func(ctx *Handler, e *Entry) bool {
-// 		if e == nil || e.Response == nil {
-// 			return false
-// 		}
-// 		_, ok := codeSet[e.Response.Status]
-// 		return ok
-// 	}
-// }
-
-// // WithResponseHandler .
-// func WithResponseHandler(handler EntityHandler) RequestOption {
-// 	return func(h *Handler) {
-// 		h.append(nil, handler)
-// 	}
-// }
+// WithResponseStatusCode selects the entries whose response status is one of codes.
+func WithResponseStatusCode(codes ...int) RequestOption {
+	var codeSet = make(map[int]struct{}, len(codes))
+	for _, c := range codes {
+		codeSet[c] = struct{}{}
+	}
+	return func(ctx *Handler, e *Entry) bool {
+		if e == nil || e.Response == nil {
+			return false
+		}
+		_, ok := codeSet[e.Response.Status]
+		return ok
+	}
+}
+
+// WithResponseStatusRange selects the entries whose response status is
+// within [min, max], e.g. WithResponseStatusRange(500, 599).
+func WithResponseStatusRange(min, max int) RequestOption {
+	return func(ctx *Handler, e *Entry) bool {
+		if e == nil || e.Response == nil {
+			return false
+		}
+		return e.Response.Status >= min && e.Response.Status <= max
+	}
+}
+
+// WithResponseMimeType selects the entries whose response content mime type
+// starts with one of types, e.g. "application/json".
+func WithResponseMimeType(types ...string) RequestOption {
+	return func(ctx *Handler, e *Entry) bool {
+		if e == nil || e.Response == nil || e.Response.Content == nil {
+			return false
+		}
+		mt := strings.ToLower(e.Response.Content.MimeType)
+		for _, t := range types {
+			if strings.HasPrefix(mt, strings.ToLower(t)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// WithResponseHeader selects the entries whose response has the header name,
+// and if values are given, whose header value is one of them.
+func WithResponseHeader(name string, values ...string) RequestOption {
+	return func(ctx *Handler, e *Entry) bool {
+		if e == nil || e.Response == nil {
+			return false
+		}
+		for _, h := range e.Response.Headers {
+			if !strings.EqualFold(h.Name, name) {
+				continue
+			}
+			if len(values) == 0 {
+				return true
+			}
+			for _, v := range values {
+				if h.Value == v {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// WithResponseBodySize selects the entries whose response body size in bytes
+// is within [min, max], a negative max means no upper bound. The decoded
+// content size is used when the body size is not available.
+func WithResponseBodySize(min, max int64) RequestOption {
+	return func(ctx *Handler, e *Entry) bool {
+		if e == nil || e.Response == nil {
+			return false
+		}
+		size := e.Response.BodySize
+		if size < 0 && e.Response.Content != nil {
+			size = e.Response.Content.Size
+		}
+		return size >= min && (max < 0 || size <= max)
+	}
+}
+
+// WithResponseBodyRegexp selects the entries whose response content matches regexps.
+func WithResponseBodyRegexp(regexps *regexp.Regexp) RequestOption {
+	return func(ctx *Handler, e *Entry) bool {
+		if regexps == nil || e == nil || e.Response == nil || e.Response.Content == nil {
+			return false
+		}
+		return regexps.Match(e.Response.Content.Text)
+	}
+}
+
+// WithEntryTime selects the entries whose total elapsed time is within
+// [min, max], a negative max means no upper bound.
+func WithEntryTime(min, max time.Duration) RequestOption {
+	return func(ctx *Handler, e *Entry) bool {
+		if e == nil {
+			return false
+		}
+		return e.Time >= millis(min) && (max < 0 || e.Time <= millis(max))
+	}
+}
+
+// WithResponseHandler selects the entries having a response for which handler returns true.
+func WithResponseHandler(handler EntityHandler) RequestOption {
+	return func(ctx *Handler, e *Entry) bool {
+		if e == nil || e.Response == nil {
+			return false
+		}
+		return handler(e)
+	}
+}
@@ -0,0 +1,161 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func selectURLs(t *testing.T, h *Handler, filter ...RequestOption) string {
+	t.Helper()
+	var urls []string
+	for _, e := range h.selectEntries(filter...) {
+		urls = append(urls, e.Request.Method+" "+e.Request.URL)
+	}
+	return strings.Join(urls, ",")
+}
+
+func TestRequestOptionAlgebra(t *testing.T) {
+	har := &Har{Log: &Log{Version: "1.2", Creator: &Creator{Name: "test", Version: "1"}}}
+	for _, r := range []struct{ method, url string }{
+		{http.MethodGet, "https://api.example.com/users"},
+		{http.MethodGet, "https://api.example.com/health"},
+		{http.MethodPost, "https://api.example.com/users"},
+		{http.MethodGet, "https://www.example.com:8443/"},
+	} {
+		har.Log.Entries = append(har.Log.Entries, &Entry{Request: &Request{Method: r.method, URL: r.url}})
+	}
+	h, err := NewHandler(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter []RequestOption
+		want   string
+	}{
+		{
+			name: "none",
+			want: "GET https://api.example.com/users,GET https://api.example.com/health," +
+				"POST https://api.example.com/users,GET https://www.example.com:8443/",
+		},
+		{
+			name: "and",
+			filter: []RequestOption{
+				WithRequestMethod("get"),
+				WithRequestHostIs("api.example.com"),
+				Not(WithRequestUrlRegexp(regexp.MustCompile(`/health$`))),
+			},
+			want: "GET https://api.example.com/users",
+		},
+		{
+			name: "or",
+			filter: []RequestOption{Any(
+				WithRequestMethod(http.MethodPost),
+				WithRequestHostIs("www.example.com"),
+			)},
+			want: "POST https://api.example.com/users,GET https://www.example.com:8443/",
+		},
+		{
+			name: "nested",
+			filter: []RequestOption{All(
+				WithSkipRequestMethod(http.MethodPost),
+				Any(WithRequestHostRegexp(regexp.MustCompile(`:8443$`)), WithRequestUrlIs("https://api.example.com/health")),
+			)},
+			want: "GET https://api.example.com/health,GET https://www.example.com:8443/",
+		},
+		{
+			name:   "empty any",
+			filter: []RequestOption{Any()},
+			want:   "",
+		},
+	} {
+		if got := selectURLs(t, h, tc.filter...); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestResponseOptions(t *testing.T) {
+	har := &Har{Log: &Log{Version: "1.2", Creator: &Creator{Name: "test", Version: "1"}}}
+	for i, r := range []struct {
+		status int
+		mime   string
+		body   string
+		time   float64
+	}{
+		{200, "application/json; charset=utf-8", `{"id": 1}`, 20},
+		{404, "text/html", "<h1>not found</h1>", 5},
+		{503, "application/json", `{"error": "unavailable"}`, 1500},
+	} {
+		har.Log.Entries = append(har.Log.Entries, &Entry{
+			Time:    r.time,
+			Request: &Request{Method: http.MethodGet, URL: "https://example.com/" + strconv.Itoa(i)},
+			Response: &Response{
+				Status:   r.status,
+				Headers:  []*NVP{{Name: "Content-Type", Value: r.mime}, {Name: "X-Status", Value: strconv.Itoa(r.status)}},
+				BodySize: -1,
+				Content:  &Content{MimeType: r.mime, Size: int64(len(r.body)), Text: []byte(r.body)},
+			},
+		})
+	}
+	h, err := NewHandler(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter RequestOption
+		want   string
+	}{
+		{"status", WithResponseStatusCode(404, 503), "1,2"},
+		{"status range", WithResponseStatusRange(500, 599), "2"},
+		{"mime type", WithResponseMimeType("Application/JSON"), "0,2"},
+		{"header presence", WithResponseHeader("x-status"), "0,1,2"},
+		{"header value", WithResponseHeader("x-status", "200", "404"), "0,1"},
+		{"body size", WithResponseBodySize(10, -1), "1,2"},
+		{"body size bounded", WithResponseBodySize(0, 10), "0"},
+		{"time", WithEntryTime(time.Second, -1), "2"},
+		{"body regexp", WithResponseBodyRegexp(regexp.MustCompile(`"error"`)), "2"},
+		{"handler", WithResponseHandler(func(e *Entry) bool { return e.Response.Status < 400 }), "0"},
+	} {
+		var got []string
+		for _, e := range h.Export(tc.filter).Log.Entries {
+			got = append(got, strings.TrimPrefix(e.Request.URL, "https://example.com/"))
+		}
+		if strings.Join(got, ",") != tc.want {
+			t.Errorf("%s: got %v, want %s", tc.name, got, tc.want)
+		}
+	}
+	if got := h.EntryTotal(); got != 3 {
+		t.Errorf("EntryTotal after filtered export: got %d, want 3", got)
+	}
+}
@@ -0,0 +1,145 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// limiter spaces out the requests it lets through by a fixed interval.
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newLimiter(rps float64) *limiter {
+	if rps <= 0 {
+		return nil
+	}
+	return &limiter{interval: time.Duration(float64(time.Second) / rps)}
+}
+
+// wait blocks until a request can be sent, it returns false if ctx is done before.
+func (l *limiter) wait(ctx context.Context) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	var (
+		now = time.Now()
+		at  = l.next
+	)
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+	return sleep(ctx, at.Sub(now))
+}
+
+// hostLimiter limits the requests sent to each host separately.
+type hostLimiter struct {
+	rps   float64
+	mu    sync.Mutex
+	hosts map[string]*limiter
+}
+
+func newHostLimiter(rps float64) *hostLimiter {
+	if rps <= 0 {
+		return nil
+	}
+	return &hostLimiter{rps: rps, hosts: make(map[string]*limiter)}
+}
+
+func (l *hostLimiter) wait(ctx context.Context, host string) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	hl, ok := l.hosts[host]
+	if !ok {
+		hl = newLimiter(l.rps)
+		l.hosts[host] = hl
+	}
+	l.mu.Unlock()
+	return hl.wait(ctx)
+}
+
+// pace waits until the request of entry can be sent according to the rate
+// limits of the Handler, see WithRateLimit and WithHostRateLimit.
+func (h *Handler) pace(ctx context.Context, entry *Entry) bool {
+	if !h.limit.wait(ctx) {
+		return false
+	}
+	if h.hostLimit == nil {
+		return true
+	}
+	u, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		return true
+	}
+	return h.hostLimit.wait(ctx, u.Host)
+}
+
+// schedule reproduces the gaps between the startedDateTime of the entries of
+// a replay, divided by speed.
+type schedule struct {
+	start time.Time
+	first time.Time
+	speed float64
+}
+
+// newSchedule returns the schedule of entries, or nil if the timing is not
+// faithful, see WithFaithfulTiming.
+func (h *Handler) newSchedule(entries []*Entry) *schedule {
+	if h.speed <= 0 {
+		return nil
+	}
+	var s = &schedule{start: time.Now(), speed: h.speed}
+	for _, e := range entries {
+		t, err := ParseISO8601(e.StartedDateTime)
+		if err == nil && (s.first.IsZero() || t.Before(s.first)) {
+			s.first = t
+		}
+	}
+	return s
+}
+
+// wait blocks until the time of e in the schedule, entries with an invalid
+// startedDateTime are not delayed. It returns false if ctx is done before.
+func (s *schedule) wait(ctx context.Context, e *Entry) bool {
+	if s == nil {
+		return true
+	}
+	t, err := ParseISO8601(e.StartedDateTime)
+	if err != nil {
+		return ctx.Err() == nil
+	}
+	var at = s.start.Add(time.Duration(float64(t.Sub(s.first)) / s.speed))
+	return sleep(ctx, time.Until(at))
+}
@@ -0,0 +1,121 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// arrivals returns a server recording the arrival time of the requests.
+func arrivals(t *testing.T) (*httptest.Server, func() []time.Duration) {
+	var (
+		mu    sync.Mutex
+		times []time.Time
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		times = append(times, time.Now())
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []time.Duration {
+		mu.Lock()
+		defer mu.Unlock()
+		var gaps []time.Duration
+		for i := 1; i < len(times); i++ {
+			gaps = append(gaps, times[i].Sub(times[i-1]))
+		}
+		return gaps
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opt  Option
+	}{
+		{"global", WithRateLimit(20)},
+		{"host", WithHostRateLimit(20)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, gaps := arrivals(t)
+			other, otherGaps := arrivals(t)
+			har := newReplayHar(srv.URL, []string{"/a", "/b", "/c"}, []time.Duration{0, 0, 0})
+			har.Log.Entries = append(har.Log.Entries,
+				newReplayHar(other.URL, []string{"/a", "/b"}, []time.Duration{0, 0}).Log.Entries...)
+			h, err := NewHandler(har, tc.opt, WithRequestConcurrency(0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			receipt, err := h.SyncExecute(context.TODO())
+			if err != nil {
+				t.Fatalf("SyncExecute: %s", err)
+			}
+			for r := range receipt {
+				if r.Error() != nil {
+					t.Fatalf("execute: %s", r.Error())
+				}
+			}
+			// the arrivals are late by the scheduling of the server, a single
+			// gap may be shortened but not the span of the requests
+			for _, gaps := range [][]time.Duration{gaps(), otherGaps()} {
+				var span time.Duration
+				for _, g := range gaps {
+					span += g
+					if g < 25*time.Millisecond {
+						t.Errorf("gap %s, want about 50ms", g)
+					}
+				}
+				if want := time.Duration(len(gaps))*50*time.Millisecond - 10*time.Millisecond; span < want {
+					t.Errorf("span %s, want at least %s", span, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFaithfulTiming(t *testing.T) {
+	srv, gaps := arrivals(t)
+	har := newReplayHar(srv.URL, []string{"/a", "/b", "/c"}, []time.Duration{0, 100 * time.Millisecond, 300 * time.Millisecond})
+	h, err := NewHandler(har, WithFaithfulTiming(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range h.Replay(context.TODO()) {
+		if err != nil {
+			t.Fatalf("replay: %s", err)
+		}
+	}
+	got := gaps()
+	for i, want := range []time.Duration{50 * time.Millisecond, 100 * time.Millisecond} {
+		if got[i] < want-10*time.Millisecond || got[i] > want+200*time.Millisecond {
+			t.Errorf("gap %d: got %s, want about %s", i, got[i], want)
+		}
+	}
+}
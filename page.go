@@ -0,0 +1,135 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"fmt"
+	"time"
+)
+
+// StartPage adds a new Page to the Har and makes it the current page,
+// entries recorded until FinishPage is called refer to it.
+func (h *Handler) StartPage(id, title string) (*Page, error) {
+	if id == "" {
+		return nil, fmt.Errorf("go-har: page id is empty")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.findPage(id) != nil {
+		return nil, fmt.Errorf("go-har: duplicate page id: %s", id)
+	}
+	var page = &Page{
+		StartedDateTime: time.Now().UTC().Format(time.RFC3339Nano),
+		ID:              id,
+		Title:           title,
+		PageTimings:     &PageTimings{OnContentLoad: -1, OnLoad: -1},
+		Comment:         h.comment,
+	}
+	h.har.Log.Pages = append(h.har.Log.Pages, page)
+	h.page = id
+	return page, nil
+}
+
+// FinishPage sets the timings of the page and stops attaching new entries to
+// it. If timings is nil, onLoad is set to the time elapsed since the page started.
+func (h *Handler) FinishPage(id string, timings *PageTimings) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var page = h.findPage(id)
+	if page == nil {
+		return fmt.Errorf("go-har: page not found: %s", id)
+	}
+	if timings == nil {
+		timings = &PageTimings{OnContentLoad: -1, OnLoad: -1}
+		if t, err := ParseISO8601(page.StartedDateTime); err == nil {
+			timings.OnLoad = millis(time.Since(t))
+		}
+	}
+	page.PageTimings = timings
+	if h.page == id {
+		h.page = ""
+	}
+	if h.stream != nil {
+		return h.stream.WritePage(page)
+	}
+	return nil
+}
+
+// SetPageRef attaches the entry recorded with the given id to the page.
+func (h *Handler) SetPageRef(entryID, pageID string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e, ok := h.entries[entryID]
+	if !ok {
+		return fmt.Errorf("go-har: entry not found: %s", entryID)
+	}
+	if h.findPage(pageID) == nil {
+		return fmt.Errorf("go-har: page not found: %s", pageID)
+	}
+	e.PageRef = pageID
+	return nil
+}
+
+// Page returns the page with the given id or nil if it does not exist.
+func (h *Handler) Page(id string) *Page {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.findPage(id)
+}
+
+// Pages returns all the pages of the Har.
+func (h *Handler) Pages() []*Page {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var pages = make([]*Page, len(h.har.Log.Pages))
+	copy(pages, h.har.Log.Pages)
+	return pages
+}
+
+// PageEntries returns the entries referring to the page with the given id,
+// in the order of the Har. An empty id returns the entries without a page.
+func (h *Handler) PageEntries(id string) []*Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var entries []*Entry
+	for _, e := range h.har.Log.Entries {
+		if e.PageRef == id {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func (h *Handler) findPage(id string) *Page {
+	for _, p := range h.har.Log.Pages {
+		if p != nil && p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPages(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	h, err := NewHandler(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: h.RoundTripper(nil)}
+	get := func() {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get: %s", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	if _, err := h.StartPage("page_1", "home"); err != nil {
+		t.Fatalf("StartPage: %s", err)
+	}
+	if _, err := h.StartPage("page_1", "home"); err == nil {
+		t.Error("StartPage: want duplicate page id error")
+	}
+	get()
+	get()
+	if err := h.FinishPage("page_1", nil); err != nil {
+		t.Fatalf("FinishPage: %s", err)
+	}
+	get()
+
+	if got := len(h.PageEntries("page_1")); got != 2 {
+		t.Errorf("PageEntries(page_1): got %d, want 2", got)
+	}
+	if got := len(h.PageEntries("")); got != 1 {
+		t.Errorf("PageEntries(): got %d, want 1", got)
+	}
+	if p := h.Page("page_1"); p == nil || p.PageTimings.OnLoad < 0 {
+		t.Errorf("Page(page_1): got %+v", p)
+	}
+	if err := h.Export().Validate(true); err != nil {
+		t.Errorf("Validate: %s", err)
+	}
+}
+
+func TestPageEntries(t *testing.T) {
+	h, err := Parse("./testdata/zh.wikipedia.org.har")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(h.Pages()); got != 1 {
+		t.Fatalf("Pages: got %d, want 1", got)
+	}
+	if got := len(h.PageEntries("page_1")); got != 3 {
+		t.Errorf("PageEntries(page_1): got %d, want 3", got)
+	}
+}
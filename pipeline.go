@@ -0,0 +1,304 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Extractor sets variables of a Pipeline from the response of a replayed entry.
+type Extractor func(r *Receipt, vars map[string]string)
+
+// ExtractJSON sets the variable name to the value at path of a JSON response
+// body, decoded as by Receipt.DecodedBody. The path is a subset of JSONPath
+// made of fields and indexes, such as $.data.items[0].id or $['access_token'].
+// Strings are set as is, other values as JSON. It panics if the path is
+// invalid, as regexp.MustCompile does.
+func ExtractJSON(name, path string) Extractor {
+	keys, err := parseJSONPath(path)
+	if err != nil {
+		panic(err)
+	}
+	return func(r *Receipt, vars map[string]string) {
+		body, err := r.DecodedBody()
+		if err != nil {
+			return
+		}
+		var v any
+		d := json.NewDecoder(bytes.NewReader(body))
+		d.UseNumber()
+		if d.Decode(&v) != nil {
+			return
+		}
+		for _, k := range keys {
+			switch x := v.(type) {
+			case map[string]any:
+				v = x[k]
+			case []any:
+				i, err := strconv.Atoi(k)
+				if err != nil || i < 0 || i >= len(x) {
+					return
+				}
+				v = x[i]
+			default:
+				return
+			}
+			if v == nil {
+				return
+			}
+		}
+		switch x := v.(type) {
+		case string:
+			vars[name] = x
+		default:
+			b, _ := json.Marshal(x)
+			vars[name] = string(b)
+		}
+	}
+}
+
+// parseJSONPath returns the keys of a path given to ExtractJSON.
+func parseJSONPath(path string) ([]string, error) {
+	var (
+		keys []string
+		rest = strings.TrimPrefix(path, "$")
+	)
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			i := strings.IndexAny(rest, ".[")
+			if i < 0 {
+				i = len(rest)
+			}
+			if i == 0 {
+				return nil, fmt.Errorf("go-har: invalid json path %q", path)
+			}
+			keys, rest = append(keys, rest[:i]), rest[i:]
+		case '[':
+			i := strings.IndexByte(rest, ']')
+			if i < 0 {
+				return nil, fmt.Errorf("go-har: invalid json path %q", path)
+			}
+			keys, rest = append(keys, strings.Trim(rest[1:i], `'"`)), rest[i+1:]
+		default:
+			return nil, fmt.Errorf("go-har: invalid json path %q", path)
+		}
+	}
+	return keys, nil
+}
+
+// ExtractRegexp sets the variable name to the first submatch of re in the
+// decoded response body, or to the whole match if re has no group.
+func ExtractRegexp(name string, re *regexp.Regexp) Extractor {
+	return func(r *Receipt, vars map[string]string) {
+		body, err := r.DecodedBody()
+		if err != nil {
+			return
+		}
+		m := re.FindSubmatch(body)
+		if m == nil {
+			return
+		}
+		vars[name] = string(m[min(1, len(m)-1)])
+	}
+}
+
+// ExtractHeader sets the variable name to the value of the response header.
+func ExtractHeader(name, header string) Extractor {
+	return func(r *Receipt, vars map[string]string) {
+		if vs := r.Response.Header.Values(header); len(vs) > 0 {
+			vars[name] = vs[0]
+		}
+	}
+}
+
+// ExtractCookie sets the variable name to the value of the cookie set by the response.
+func ExtractCookie(name, cookie string) Extractor {
+	return func(r *Receipt, vars map[string]string) {
+		for _, c := range r.Response.Cookies() {
+			if c.Name == cookie {
+				vars[name] = c.Value
+			}
+		}
+	}
+}
+
+// ExtractWhen applies the extractors to the entries matching all the filters only.
+func ExtractWhen(filter RequestOption, extractors ...Extractor) Extractor {
+	return func(r *Receipt, vars map[string]string) {
+		if !filter(r.h, r.Entry) {
+			return
+		}
+		for _, ex := range extractors {
+			ex(r, vars)
+		}
+	}
+}
+
+// Pipeline replays entries in sequence like Handler.Execute, carrying values
+// from the responses to the following requests: the extractors set variables
+// from each replayed response, and the placeholders {{name}} in the url, the
+// headers, the query string, the cookies and the post data of the following
+// entries are replaced by the variables before they are sent.
+// Placeholders of unknown variables are sent as is.
+// The extractors read Receipt.Body, so WithResponseStream must not be enabled.
+type Pipeline struct {
+	h          *Handler
+	extractors []Extractor
+	mu         sync.Mutex
+	vars       map[string]string
+}
+
+// NewPipeline returns a Pipeline replaying the entries of h.
+func (h *Handler) NewPipeline(extractors ...Extractor) *Pipeline {
+	return &Pipeline{h: h, extractors: extractors, vars: make(map[string]string)}
+}
+
+// Set sets the variable name, e.g. the credentials used by a replayed login.
+func (p *Pipeline) Set(name, value string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.vars[name] = value
+}
+
+// Vars returns a copy of the variables set so far.
+func (p *Pipeline) Vars() map[string]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return maps.Clone(p.vars)
+}
+
+// Execute replays the entries matching all the filters in sequence, the
+// receipts refer to the recorded entries while the requests sent are
+// templated copies of them.
+func (p *Pipeline) Execute(ctx context.Context, filter ...RequestOption) ([]Receipt, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var (
+		h       = p.h
+		entries = h.selectEntries(filter...)
+		receipt = make([]Receipt, 0, len(entries))
+		client  = h.client()
+		sched   = h.newSchedule(entries)
+	)
+	for _, entry := range entries {
+		sched.wait(ctx, entry)
+		p.mu.Lock()
+		var templated = templateEntry(entry, p.vars)
+		p.mu.Unlock()
+
+		var r = h.replay(ctx, client, templated, h.cookie)
+		r.Entry = entry
+		if r.err == nil {
+			p.mu.Lock()
+			for _, ex := range p.extractors {
+				ex(&r, p.vars)
+			}
+			p.mu.Unlock()
+		}
+		receipt = append(receipt, r)
+	}
+	return receipt, nil
+}
+
+var placeholder = regexp.MustCompile(`\{\{\s*([\w.-]+)\s*\}\}`)
+
+// expand replaces the placeholders of s by the variables.
+func expand(s string, vars map[string]string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	return placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		if v, ok := vars[placeholder.FindStringSubmatch(m)[1]]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+// templateEntry returns a copy of e whose request placeholders are replaced by
+// the variables, e is left unchanged.
+func templateEntry(e *Entry, vars map[string]string) *Entry {
+	var (
+		entry = *e
+		req   = *e.Request
+	)
+	req.URL = expand(req.URL, vars)
+	req.Headers = expandNVPs(req.Headers, vars)
+	req.QueryString = expandNVPs(req.QueryString, vars)
+	// the url carries the query string sent, rebuild it from the parameters
+	// when a placeholder of them is replaced.
+	if !slices.EqualFunc(req.QueryString, e.Request.QueryString, func(a, b *NVP) bool {
+		return a.Name == b.Name && a.Value == b.Value
+	}) {
+		if u, err := url.Parse(req.URL); err == nil {
+			u.RawQuery = encodeQuery(req.QueryString)
+			req.URL = u.String()
+		}
+	}
+	req.Cookies = make([]*Cookie, 0, len(e.Request.Cookies))
+	for _, c := range e.Request.Cookies {
+		var cookie = *c
+		cookie.Value = expand(c.Value, vars)
+		req.Cookies = append(req.Cookies, &cookie)
+	}
+	if e.Request.PostData != nil {
+		var pd = *e.Request.PostData
+		pd.Text = expand(pd.Text, vars)
+		pd.Params = make([]*PostParam, 0, len(e.Request.PostData.Params))
+		for _, p := range e.Request.PostData.Params {
+			var param = *p
+			param.Name = expand(p.Name, vars)
+			param.Value = expand(p.Value, vars)
+			pd.Params = append(pd.Params, &param)
+		}
+		req.PostData = &pd
+	}
+	entry.Request = &req
+	return &entry
+}
+
+func expandNVPs(nvps []*NVP, vars map[string]string) []*NVP {
+	var s = make([]*NVP, 0, len(nvps))
+	for _, v := range nvps {
+		var nvp = *v
+		nvp.Name = expand(v.Name, vars)
+		nvp.Value = expand(v.Value, vars)
+		s = append(s, &nvp)
+	}
+	return s
+}
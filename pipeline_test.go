@@ -0,0 +1,174 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			w.Header().Set("X-Csrf-Token", "c-1")
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "s-1"})
+			_, _ = io.WriteString(w, `{"data":{"tokens":[{"access_token":"t-1"}],"ttl":3600}}`)
+		case "/items":
+			body, _ := io.ReadAll(r.Body)
+			_, _ = fmt.Fprintf(w, `<input name="id" value="42"> %s`, body)
+		default:
+			_, _ = fmt.Fprintf(w, "%s %s %s %s", r.URL.Path, r.Header.Get("Authorization"),
+				r.URL.Query().Get("csrf"), r.URL.Query().Get("missing"))
+		}
+	}))
+	defer srv.Close()
+
+	var (
+		har     = newReplayHar(srv.URL, []string{"/login", "/items", "/items/{{id}}?csrf={{csrf}}&missing={{missing}}"}, []time.Duration{0, 1, 2})
+		items   = har.Log.Entries[1].Request
+		item    = har.Log.Entries[2].Request
+		itemURL = item.URL
+	)
+	items.Method = http.MethodPost
+	items.Headers = []*NVP{{Name: "Content-Type", Value: "application/x-www-form-urlencoded"}}
+	items.PostData = &PostData{
+		MimeType: "application/x-www-form-urlencoded",
+		Params:   []*PostParam{{Name: "sid", Value: "{{sid}}"}, {Name: "user", Value: "{{user}}"}},
+	}
+	item.Headers = []*NVP{{Name: "Authorization", Value: "Bearer {{ token }}"}}
+
+	h, err := NewHandler(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := h.NewPipeline(
+		ExtractWhen(WithRequestUrlIs(srv.URL+"/login"),
+			ExtractJSON("token", "$.data.tokens[0]['access_token']"),
+			ExtractJSON("ttl", "$.data.ttl"),
+			ExtractHeader("csrf", "X-Csrf-Token"),
+			ExtractCookie("sid", "sid"),
+		),
+		ExtractRegexp("id", regexp.MustCompile(`name="id" value="(\d+)"`)),
+	)
+	p.Set("user", "go-har")
+
+	receipts, err := p.Execute(context.TODO())
+	if err != nil {
+		t.Fatalf("Execute: %s", err)
+	}
+	for i, want := range []string{
+		"",
+		`<input name="id" value="42"> sid=s-1&user=go-har`,
+		"/items/42 Bearer t-1 c-1 {{missing}}",
+	} {
+		r := receipts[i]
+		if r.Error() != nil {
+			t.Fatalf("%s: %s", r.Entry.Request.URL, r.Error())
+		}
+		if r.Entry != har.Log.Entries[i] {
+			t.Errorf("receipt %d: not the recorded entry", i)
+		}
+		if i > 0 && string(r.Body()) != want {
+			t.Errorf("receipt %d: got %q, want %q", i, r.Body(), want)
+		}
+	}
+	if item.URL != itemURL {
+		t.Errorf("recorded url changed: %s", item.URL)
+	}
+
+	vars := p.Vars()
+	for k, v := range map[string]string{"token": "t-1", "ttl": "3600", "csrf": "c-1", "sid": "s-1", "id": "42", "user": "go-har"} {
+		if vars[k] != v {
+			t.Errorf("var %s: got %q, want %q", k, vars[k], v)
+		}
+	}
+}
+
+func TestPipelineEncodedQuery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "gzip")
+			gw := gzip.NewWriter(w)
+			_, _ = io.WriteString(gw, `{"token":"t-2","csrf":"c-2"}`)
+			_ = gw.Close()
+			return
+		}
+		_, _ = io.WriteString(w, r.URL.RawQuery)
+	}))
+	defer srv.Close()
+
+	var (
+		har   = newReplayHar(srv.URL, []string{"/login", "/items?token=old&q=a+b"}, []time.Duration{0, 1})
+		login = har.Log.Entries[0].Request
+		items = har.Log.Entries[1].Request
+	)
+	// browsers record the Accept-Encoding header, the transport keeps the body encoded
+	login.Headers = []*NVP{{Name: "Accept-Encoding", Value: "gzip, deflate, br"}}
+	items.QueryString = []*NVP{{Name: "token", Value: "{{token}}"}, {Name: "q", Value: "a b"}}
+
+	h, err := NewHandler(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := h.NewPipeline(
+		ExtractJSON("token", "$.token"),
+		ExtractRegexp("csrf", regexp.MustCompile(`"csrf":"([^"]+)"`)),
+	)
+	receipts, err := p.Execute(context.TODO())
+	if err != nil {
+		t.Fatalf("Execute: %s", err)
+	}
+	vars := p.Vars()
+	if vars["token"] != "t-2" || vars["csrf"] != "c-2" {
+		t.Errorf("vars: got %v", vars)
+	}
+	if got := string(receipts[1].Body()); got != "token=t-2&q=a+b" {
+		t.Errorf("query: got %q, want %q", got, "token=t-2&q=a+b")
+	}
+	if items.URL != srv.URL+"/items?token=old&q=a+b" {
+		t.Errorf("recorded url changed: %s", items.URL)
+	}
+}
+
+func TestExtractJSONInvalidPath(t *testing.T) {
+	for _, path := range []string{"$.data..id", "$.items[0", "data"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("ExtractJSON(%q): want a panic", path)
+				}
+			}()
+			ExtractJSON("id", path)
+		}()
+	}
+}
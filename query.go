@@ -0,0 +1,688 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseQuery parses a selection expression into a RequestOption, so that
+// entries can be selected from configuration files.
+//
+// An expression compares fields of the entry with literals, and combines
+// comparisons with &&, || and ! (or and, or, not) and parentheses:
+//
+//	method == "POST" && url ~ "/api/" && response.status >= 400 && header("content-type") contains "json"
+//
+// The comparison operators are ==, !=, <, <=, >, >=, ~ and !~ (regular
+// expression), contains, startswith and endswith. Numbers are compared
+// numerically, anything else as strings. Strings are double-quoted with the
+// escapes of Go, or single-quoted where only \' and \\ are escapes, which
+// suits regular expressions such as url ~ '/users/\d+'.
+//
+// Fields are case-insensitive:
+//
+//	id, startedDateTime, time, serverIPAddress, connection, comment
+//	method, url, host, path, scheme (also prefixed by "request.")
+//	request.httpVersion, request.headersSize, request.bodySize, request.mimeType, request.body
+//	status, response.status, response.statusText, response.httpVersion, response.mimeType,
+//	response.body, response.bodySize, response.headersSize, response.redirectURL
+//	timings.blocked, timings.dns, timings.connect, timings.ssl, timings.send, timings.wait, timings.receive
+//	pageref, page.id, page.title, page.startedDateTime, page.onContentLoad, page.onLoad
+//
+// The functions header(name), query(name) and cookie(name) return the values
+// of the request and response headers, the query string parameters and the
+// request and response cookies with the given name, header and cookie can be
+// prefixed by "request." or "response.". A comparison holds if any of the
+// values satisfies it, except for != and !~ which hold if none is equal or
+// matches.
+func ParseQuery(expr string) (RequestOption, error) {
+	p := &queryParser{expr: expr}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+	node, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %s", tok)
+	}
+	return func(ctx *Handler, e *Entry) bool {
+		return e != nil && node(ctx, e)
+	}, nil
+}
+
+// QueryError describes an error in a selection expression.
+type QueryError struct {
+	// Expr is the parsed expression.
+	Expr string
+	// Pos is the byte offset of the error in Expr.
+	Pos int
+	// Msg describes the error.
+	Msg string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("go-har: query: %s at position %d: %s", e.Msg, e.Pos, e.Expr)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.value)
+	default:
+		return fmt.Sprintf("%q", t.value)
+	}
+}
+
+type queryParser struct {
+	expr   string
+	tokens []token
+	i      int
+}
+
+func (p *queryParser) errorf(tok token, format string, args ...any) error {
+	return &QueryError{Expr: p.expr, Pos: tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// queryKeywords are the word operators, they are case-insensitive.
+var queryKeywords = map[string]tokenKind{
+	"and":        tokAnd,
+	"or":         tokOr,
+	"not":        tokNot,
+	"contains":   tokOp,
+	"startswith": tokOp,
+	"endswith":   tokOp,
+}
+
+func (p *queryParser) lex() error {
+	var s = p.expr
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			p.tokens = append(p.tokens, token{kind: tokLParen, value: "(", pos: i})
+			i++
+		case c == ')':
+			p.tokens = append(p.tokens, token{kind: tokRParen, value: ")", pos: i})
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(s) {
+				return &QueryError{Expr: p.expr, Pos: i, Msg: "unterminated string"}
+			}
+			var value string
+			if c == '"' {
+				v, err := strconv.Unquote(s[i : j+1])
+				if err != nil {
+					return &QueryError{Expr: p.expr, Pos: i, Msg: "invalid string: " + err.Error()}
+				}
+				value = v
+			} else {
+				// other backslashes are kept for regular expressions
+				value = strings.NewReplacer(`\'`, "'", `\\`, `\`).Replace(s[i+1 : j])
+			}
+			p.tokens = append(p.tokens, token{kind: tokString, value: value, pos: i})
+			i = j + 1
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			if _, err := strconv.ParseFloat(s[i:j], 64); err != nil {
+				return &QueryError{Expr: p.expr, Pos: i, Msg: fmt.Sprintf("invalid number %q", s[i:j])}
+			}
+			p.tokens = append(p.tokens, token{kind: tokNumber, value: s[i:j], pos: i})
+			i = j
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || s[j] == '.' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			var (
+				word = s[i:j]
+				kind = tokIdent
+			)
+			if k, ok := queryKeywords[strings.ToLower(word)]; ok {
+				kind = k
+				word = strings.ToLower(word)
+			}
+			p.tokens = append(p.tokens, token{kind: kind, value: word, pos: i})
+			i = j
+		default:
+			var op string
+			for _, o := range []string{"&&", "||", "==", "!=", "<=", ">=", "!~", "<", ">", "~", "!"} {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			switch op {
+			case "":
+				return &QueryError{Expr: p.expr, Pos: i, Msg: fmt.Sprintf("unexpected character %q", c)}
+			case "&&":
+				p.tokens = append(p.tokens, token{kind: tokAnd, value: op, pos: i})
+			case "||":
+				p.tokens = append(p.tokens, token{kind: tokOr, value: op, pos: i})
+			case "!":
+				p.tokens = append(p.tokens, token{kind: tokNot, value: op, pos: i})
+			default:
+				p.tokens = append(p.tokens, token{kind: tokOp, value: op, pos: i})
+			}
+			i += len(op)
+		}
+	}
+	p.tokens = append(p.tokens, token{kind: tokEOF, pos: len(s)})
+	return nil
+}
+
+func (p *queryParser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *queryParser) next() token {
+	tok := p.tokens[p.i]
+	if tok.kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+// or := and ( "||" and )*
+func (p *queryParser) or() (RequestOption, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	var nodes = []RequestOption{left}
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, right)
+	}
+	if len(nodes) == 1 {
+		return left, nil
+	}
+	return Any(nodes...), nil
+}
+
+// and := unary ( "&&" unary )*
+func (p *queryParser) and() (RequestOption, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	var nodes = []RequestOption{left}
+	for p.peek().kind == tokAnd {
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, right)
+	}
+	if len(nodes) == 1 {
+		return left, nil
+	}
+	return All(nodes...), nil
+}
+
+// unary := "!" unary | "(" or ")" | comparison
+func (p *queryParser) unary() (RequestOption, error) {
+	switch tok := p.peek(); tok.kind {
+	case tokNot:
+		p.next()
+		node, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(node), nil
+	case tokLParen:
+		p.next()
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != tokRParen {
+			return nil, p.errorf(tok, "expected \")\", got %s", tok)
+		}
+		return node, nil
+	default:
+		return p.comparison()
+	}
+}
+
+// comparison := operand op operand
+func (p *queryParser) comparison() (RequestOption, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	op := p.next()
+	if op.kind != tokOp {
+		return nil, p.errorf(op, "expected a comparison operator, got %s", op)
+	}
+	right, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	var re *regexp.Regexp
+	if op.value == "~" || op.value == "!~" {
+		if right.literal == nil {
+			return nil, p.errorf(right.tok, "expected a regular expression string")
+		}
+		if re, err = regexp.Compile(right.literal[0]); err != nil {
+			return nil, p.errorf(right.tok, "invalid regular expression: %s", err)
+		}
+	}
+
+	// != and !~ hold if no pair of values is equal or matches
+	var negate bool
+	switch op.value {
+	case "!=":
+		op.value, negate = "==", true
+	case "!~":
+		op.value, negate = "~", true
+	}
+	var cmp = compareFunc(op.value, re)
+	return func(ctx *Handler, e *Entry) bool {
+		return anyPair(left.values(ctx, e), right.values(ctx, e), cmp) != negate
+	}, nil
+}
+
+// operand is either a literal or a field of the entry.
+type operand struct {
+	tok     token
+	literal []string
+	field   func(h *Handler, e *Entry) []string
+}
+
+func (o *operand) values(h *Handler, e *Entry) []string {
+	if o.literal != nil {
+		return o.literal
+	}
+	return o.field(h, e)
+}
+
+// operand := string | number | field | function "(" string ")"
+func (p *queryParser) operand() (*operand, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokString, tokNumber:
+		return &operand{tok: tok, literal: []string{tok.value}}, nil
+	case tokIdent:
+	default:
+		return nil, p.errorf(tok, "expected a field or a value, got %s", tok)
+	}
+
+	var name = strings.ToLower(tok.value)
+	if p.peek().kind != tokLParen {
+		field, ok := queryFields[name]
+		if !ok {
+			return nil, p.errorf(tok, "unknown field %q", tok.value)
+		}
+		return &operand{tok: tok, field: field}, nil
+	}
+
+	fn, ok := queryFunctions[name]
+	if !ok {
+		return nil, p.errorf(tok, "unknown function %q", tok.value)
+	}
+	p.next()
+	arg := p.next()
+	if arg.kind != tokString {
+		return nil, p.errorf(arg, "expected a string argument, got %s", arg)
+	}
+	if end := p.next(); end.kind != tokRParen {
+		return nil, p.errorf(end, "expected \")\", got %s", end)
+	}
+	return &operand{tok: tok, field: fn(arg.value)}, nil
+}
+
+func anyPair(left, right []string, cmp func(a, b string) bool) bool {
+	for _, l := range left {
+		for _, r := range right {
+			if cmp(l, r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func compareFunc(op string, re *regexp.Regexp) func(a, b string) bool {
+	switch op {
+	case "~":
+		return func(a, _ string) bool { return re.MatchString(a) }
+	case "contains":
+		return strings.Contains
+	case "startswith":
+		return strings.HasPrefix
+	case "endswith":
+		return strings.HasSuffix
+	}
+	return func(a, b string) bool {
+		var c int
+		fa, errA := strconv.ParseFloat(a, 64)
+		fb, errB := strconv.ParseFloat(b, 64)
+		if errA == nil && errB == nil {
+			switch {
+			case fa < fb:
+				c = -1
+			case fa > fb:
+				c = 1
+			}
+		} else {
+			c = strings.Compare(a, b)
+		}
+		switch op {
+		case "==":
+			return c == 0
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		case ">=":
+			return c >= 0
+		}
+		return false
+	}
+}
+
+func str(v string) []string {
+	return []string{v}
+}
+
+func num[T int | int64 | float64](v T) []string {
+	return []string{strconv.FormatFloat(float64(v), 'f', -1, 64)}
+}
+
+func requestURL(e *Entry) *url.URL {
+	if e.Request == nil {
+		return nil
+	}
+	u, err := url.Parse(e.Request.URL)
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+// request, response, timings and page fields return nothing when absent.
+func requestField(fn func(r *Request) []string) func(h *Handler, e *Entry) []string {
+	return func(h *Handler, e *Entry) []string {
+		if e.Request == nil {
+			return nil
+		}
+		return fn(e.Request)
+	}
+}
+
+func responseField(fn func(r *Response) []string) func(h *Handler, e *Entry) []string {
+	return func(h *Handler, e *Entry) []string {
+		if e.Response == nil {
+			return nil
+		}
+		return fn(e.Response)
+	}
+}
+
+func urlField(fn func(u *url.URL) string) func(h *Handler, e *Entry) []string {
+	return func(h *Handler, e *Entry) []string {
+		if u := requestURL(e); u != nil {
+			return str(fn(u))
+		}
+		return nil
+	}
+}
+
+func timingsField(fn func(t *Timings) float64) func(h *Handler, e *Entry) []string {
+	return func(h *Handler, e *Entry) []string {
+		if e.Timings == nil {
+			return nil
+		}
+		return num(fn(e.Timings))
+	}
+}
+
+func pageField(fn func(p *Page) []string) func(h *Handler, e *Entry) []string {
+	return func(h *Handler, e *Entry) []string {
+		if h == nil || e.PageRef == "" {
+			return nil
+		}
+		if p := h.findPage(e.PageRef); p != nil {
+			return fn(p)
+		}
+		return nil
+	}
+}
+
+func postText(r *Request) []string {
+	if r.PostData == nil {
+		return nil
+	}
+	if len(r.PostData.Params) == 0 {
+		return str(r.PostData.Text)
+	}
+	var form = make(url.Values)
+	for _, p := range r.PostData.Params {
+		form.Add(p.Name, p.Value)
+	}
+	return str(form.Encode())
+}
+
+func contentText(r *Response) []string {
+	if r.Content == nil {
+		return nil
+	}
+	return str(string(r.Content.Text))
+}
+
+var queryFields = map[string]func(h *Handler, e *Entry) []string{
+	"id":              func(h *Handler, e *Entry) []string { return str(e.ID) },
+	"starteddatetime": func(h *Handler, e *Entry) []string { return str(e.StartedDateTime) },
+	"time":            func(h *Handler, e *Entry) []string { return num(e.Time) },
+	"serveripaddress": func(h *Handler, e *Entry) []string { return str(e.ServerIPAddress) },
+	"connection":      func(h *Handler, e *Entry) []string { return str(e.Connection) },
+	"comment":         func(h *Handler, e *Entry) []string { return str(e.Comment) },
+	"pageref":         func(h *Handler, e *Entry) []string { return str(e.PageRef) },
+
+	"request.method":      requestField(func(r *Request) []string { return str(r.Method) }),
+	"request.url":         requestField(func(r *Request) []string { return str(r.URL) }),
+	"request.host":        urlField(func(u *url.URL) string { return u.Host }),
+	"request.path":        urlField(func(u *url.URL) string { return u.Path }),
+	"request.scheme":      urlField(func(u *url.URL) string { return u.Scheme }),
+	"request.httpversion": requestField(func(r *Request) []string { return str(r.HTTPVersion) }),
+	"request.headerssize": requestField(func(r *Request) []string { return num(r.HeaderSize) }),
+	"request.bodysize":    requestField(func(r *Request) []string { return num(r.BodySize) }),
+	"request.body":        requestField(postText),
+	"request.mimetype": requestField(func(r *Request) []string {
+		if r.PostData == nil {
+			return nil
+		}
+		return str(r.PostData.MimeType)
+	}),
+
+	"response.status":      responseField(func(r *Response) []string { return num(r.Status) }),
+	"response.statustext":  responseField(func(r *Response) []string { return str(r.StatusText) }),
+	"response.httpversion": responseField(func(r *Response) []string { return str(r.HTTPVersion) }),
+	"response.bodysize":    responseField(func(r *Response) []string { return num(r.BodySize) }),
+	"response.headerssize": responseField(func(r *Response) []string { return num(r.HeadersSize) }),
+	"response.redirecturl": responseField(func(r *Response) []string { return str(r.RedirectURL) }),
+	"response.body":        responseField(contentText),
+	"response.mimetype": responseField(func(r *Response) []string {
+		if r.Content == nil {
+			return nil
+		}
+		return str(r.Content.MimeType)
+	}),
+
+	"timings.blocked": timingsField(func(t *Timings) float64 { return t.Blocked }),
+	"timings.dns":     timingsField(func(t *Timings) float64 { return t.DNS }),
+	"timings.connect": timingsField(func(t *Timings) float64 { return t.Connect }),
+	"timings.ssl":     timingsField(func(t *Timings) float64 { return t.Ssl }),
+	"timings.send":    timingsField(func(t *Timings) float64 { return t.Send }),
+	"timings.wait":    timingsField(func(t *Timings) float64 { return t.Wait }),
+	"timings.receive": timingsField(func(t *Timings) float64 { return t.Receive }),
+
+	"page.id":              pageField(func(p *Page) []string { return str(p.ID) }),
+	"page.title":           pageField(func(p *Page) []string { return str(p.Title) }),
+	"page.starteddatetime": pageField(func(p *Page) []string { return str(p.StartedDateTime) }),
+	"page.oncontentload": pageField(func(p *Page) []string {
+		if p.PageTimings == nil {
+			return nil
+		}
+		return num(p.PageTimings.OnContentLoad)
+	}),
+	"page.onload": pageField(func(p *Page) []string {
+		if p.PageTimings == nil {
+			return nil
+		}
+		return num(p.PageTimings.OnLoad)
+	}),
+}
+
+func init() {
+	// shorthands of the request and response fields
+	for _, name := range []string{"method", "url", "host", "path", "scheme"} {
+		queryFields[name] = queryFields["request."+name]
+	}
+	queryFields["status"] = queryFields["response.status"]
+}
+
+func nvpValues(name string, nvps ...[]*NVP) []string {
+	var values []string
+	for _, list := range nvps {
+		for _, v := range list {
+			if strings.EqualFold(v.Name, name) {
+				values = append(values, v.Value)
+			}
+		}
+	}
+	return values
+}
+
+func cookieValues(name string, cookies ...[]*Cookie) []string {
+	var values []string
+	for _, list := range cookies {
+		for _, c := range list {
+			if c.Name == name {
+				values = append(values, c.Value)
+			}
+		}
+	}
+	return values
+}
+
+var queryFunctions = map[string]func(arg string) func(h *Handler, e *Entry) []string{
+	"header": func(name string) func(h *Handler, e *Entry) []string {
+		return func(h *Handler, e *Entry) []string {
+			var values []string
+			if e.Request != nil {
+				values = nvpValues(name, e.Request.Headers)
+			}
+			if e.Response != nil {
+				values = append(values, nvpValues(name, e.Response.Headers)...)
+			}
+			return values
+		}
+	},
+	"request.header": func(name string) func(h *Handler, e *Entry) []string {
+		return requestField(func(r *Request) []string { return nvpValues(name, r.Headers) })
+	},
+	"response.header": func(name string) func(h *Handler, e *Entry) []string {
+		return responseField(func(r *Response) []string { return nvpValues(name, r.Headers) })
+	},
+	"query": func(name string) func(h *Handler, e *Entry) []string {
+		return func(h *Handler, e *Entry) []string {
+			if e.Request != nil && len(e.Request.QueryString) > 0 {
+				return nvpValues(name, e.Request.QueryString)
+			}
+			if u := requestURL(e); u != nil {
+				return u.Query()[name]
+			}
+			return nil
+		}
+	},
+	"cookie": func(name string) func(h *Handler, e *Entry) []string {
+		return func(h *Handler, e *Entry) []string {
+			var values []string
+			if e.Request != nil {
+				values = cookieValues(name, e.Request.Cookies)
+			}
+			if e.Response != nil {
+				values = append(values, cookieValues(name, e.Response.Cookies)...)
+			}
+			return values
+		}
+	},
+	"request.cookie": func(name string) func(h *Handler, e *Entry) []string {
+		return requestField(func(r *Request) []string { return cookieValues(name, r.Cookies) })
+	},
+	"response.cookie": func(name string) func(h *Handler, e *Entry) []string {
+		return responseField(func(r *Response) []string { return cookieValues(name, r.Cookies) })
+	},
+}
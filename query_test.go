@@ -0,0 +1,141 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	har := &Har{Log: &Log{
+		Version: "1.2",
+		Creator: &Creator{Name: "test", Version: "1"},
+		Pages:   []*Page{{ID: "page_1", Title: "Checkout"}},
+	}}
+	for _, r := range []struct {
+		method, url, mime string
+		status            int
+		page              string
+		wait              float64
+	}{
+		{http.MethodPost, "https://example.com/api/orders?debug=1", "application/json", 500, "page_1", 120},
+		{http.MethodPost, "https://example.com/api/login", "text/html", 403, "", 10},
+		{http.MethodGet, "https://example.com/index.html", "text/html", 200, "page_1", 30},
+	} {
+		har.Log.Entries = append(har.Log.Entries, &Entry{
+			PageRef: r.page,
+			Time:    r.wait,
+			Request: &Request{
+				Method:  r.method,
+				URL:     r.url,
+				Headers: []*NVP{{Name: "Accept", Value: "*/*"}},
+				Cookies: []*Cookie{{Name: "session", Value: "abc"}},
+			},
+			Response: &Response{
+				Status:  r.status,
+				Headers: []*NVP{{Name: "Content-Type", Value: r.mime}},
+				Content: &Content{MimeType: r.mime, Text: []byte("status " + http.StatusText(r.status))},
+			},
+			Timings: &Timings{Wait: r.wait},
+		})
+	}
+	h, err := NewHandler(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		expr string
+		want string
+	}{
+		{`method == "POST" && url ~ "/api/" && response.status >= 400 && header("content-type") contains "json"`, "/api/orders"},
+		{`method == "POST" and not (status == 500)`, "/api/login"},
+		{`status < 300 || query("debug") == "1"`, "/api/orders,/index.html"},
+		{`path endswith ".html" or host != "example.com"`, "/index.html"},
+		{`timings.wait > 20 && page.title == 'Checkout'`, "/api/orders,/index.html"},
+		{`pageref == "" && request.cookie("session") == "abc"`, "/api/login"},
+		{`response.header("Content-Type") !~ "^text/" && response.body contains "Server Error"`, "/api/orders"},
+		{`time >= 10 && time <= 30.5 && !(method == "GET")`, "/api/login"},
+	} {
+		opt, err := ParseQuery(tc.expr)
+		if err != nil {
+			t.Errorf("ParseQuery(%s): %s", tc.expr, err)
+			continue
+		}
+		var got []string
+		for _, e := range h.Export(opt).Log.Entries {
+			got = append(got, requestURL(e).Path)
+		}
+		if strings.Join(got, ",") != tc.want {
+			t.Errorf("ParseQuery(%s): got %v, want %s", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestParseQueryString(t *testing.T) {
+	for expr, want := range map[string]string{
+		`"it's \"quoted\"\n"`: "it's \"quoted\"\n",
+		`'it\'s'`:             "it's",
+		`'\d+\\'`:             `\d+\`,
+	} {
+		p := &queryParser{expr: expr}
+		if err := p.lex(); err != nil {
+			t.Errorf("lex(%s): %s", expr, err)
+			continue
+		}
+		if got := p.tokens[0].value; p.tokens[0].kind != tokString || got != want {
+			t.Errorf("lex(%s): got %q, want %q", expr, got, want)
+		}
+	}
+}
+
+func TestParseQueryError(t *testing.T) {
+	for _, tc := range []struct {
+		expr string
+		pos  int
+	}{
+		{`method = "GET"`, 7},
+		{`methods == "GET"`, 0},
+		{`method == "GET" &&`, 18},
+		{`(status == 200`, 14},
+		{`url ~ "["`, 6},
+		{`url ~ path`, 6},
+		{`header(1) == "x"`, 7},
+		{`method == "GET`, 10},
+		{`status == 200 status`, 14},
+	} {
+		_, err := ParseQuery(tc.expr)
+		var qe *QueryError
+		if !errors.As(err, &qe) {
+			t.Errorf("ParseQuery(%s): got %v, want QueryError", tc.expr, err)
+			continue
+		}
+		if qe.Pos != tc.pos {
+			t.Errorf("ParseQuery(%s): got error %q at %d, want at %d", tc.expr, qe.Msg, qe.Pos, tc.pos)
+		}
+	}
+}
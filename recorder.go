@@ -0,0 +1,457 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recorder is an http.RoundTripper that records every round trip into the Handler.
+type recorder struct {
+	h    *Handler
+	next http.RoundTripper
+}
+
+// RoundTripper returns an http.RoundTripper that wraps next and records every
+// request and response passing through it as an Entry of the Har.
+// If next is nil, http.DefaultTransport is used.
+//
+// Example:
+//
+//	client := &http.Client{Transport: h.RoundTripper(nil)}
+func (h *Handler) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &recorder{h: h, next: next}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrip must not modify the caller's request, the snapshot replaces
+	// the body so we work on a copy.
+	var tr = newTracer()
+	req = req.Clone(httptrace.WithClientTrace(req.Context(), tr.clientTrace()))
+
+	// recording must not change the traffic, a request that cannot be
+	// recorded is sent as is.
+	nr, err := NewRequest(req, r.h.isReqBody(req))
+	if err != nil {
+		r.h.log.Error("go-har: record request %s: %s", req.URL, err)
+		return r.next.RoundTrip(req)
+	}
+	var (
+		id    = r.h.nextID()
+		entry = r.h.newEntry(tr.start, nr)
+	)
+	if err := r.h.addEntry(id, entry); err != nil {
+		r.h.log.Error("go-har: record request %s: %s", req.URL, err)
+		return r.next.RoundTrip(req)
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		r.h.complete(id)
+		return nil, err
+	}
+
+	res, err := NewResponse(resp, false)
+	if err != nil {
+		r.h.log.Error("go-har: record response %s: %s", req.URL, err)
+		r.h.complete(id)
+		return resp, nil
+	}
+	res.Comment = r.h.comment
+	r.h.setResponse(id, res, nil)
+
+	// the body is consumed by the caller, the round trip ends when it is
+	// drained, streamed responses are passed on as they arrive.
+	var body = &tracedBody{ReadCloser: resp.Body}
+	if r.h.isRespBody(resp) {
+		body.capture = &limitedBuffer{limit: r.h.recordLimit}
+	}
+	body.done = func() {
+		tr.finish()
+		var (
+			res *Response
+			err error
+		)
+		if body.capture != nil {
+			if res, err = r.response(resp, body); err != nil {
+				r.h.log.Error("go-har: record response %s: %s", req.URL, err)
+			}
+		}
+		r.h.setResponse(id, res, tr)
+		r.h.complete(id)
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// response builds the Response of resp with the body captured by b.
+func (r *recorder) response(resp *http.Response, b *tracedBody) (*Response, error) {
+	var (
+		res      = *resp
+		complete = b.eof && !b.capture.truncated
+	)
+	res.Body = io.NopCloser(&b.capture.buf)
+	nr, err := NewResponse(&res, complete)
+	if err != nil {
+		return nil, err
+	}
+	nr.Comment = r.h.comment
+	switch {
+	case b.capture.truncated:
+		nr.Content.Comment = fmt.Sprintf("go-har: body not recorded, over the limit of %d bytes", b.capture.limit)
+	case !b.eof:
+		nr.Content.Comment = fmt.Sprintf("go-har: body not recorded, closed after %d bytes", b.size)
+	}
+	if !complete && b.eof && !resp.Uncompressed {
+		nr.BodySize = b.size
+	}
+	return nr, nil
+}
+
+// tracedBody calls done once the response body has been read to the end or
+// closed, the bytes read are kept in capture if not nil.
+type tracedBody struct {
+	io.ReadCloser
+	capture *limitedBuffer
+	size    int64
+	eof     bool
+	once    sync.Once
+	done    func()
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	if b.capture != nil {
+		_, _ = b.capture.Write(p[:n])
+	}
+	if err != nil {
+		b.eof = err == io.EOF
+		b.once.Do(b.done)
+	}
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	b.once.Do(b.done)
+	return b.ReadCloser.Close()
+}
+
+// setResponse sets the response and/or the traced timings and connection
+// of the entry identified by id.
+func (h *Handler) setResponse(id string, resp *Response, tr *tracer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e, ok := h.entries[id]
+	if !ok {
+		return
+	}
+	if resp != nil {
+		e.Response = resp
+	}
+	if tr != nil {
+		tr.apply(e)
+	}
+}
+
+// Middleware returns an http.Handler that serves next and records every
+// inbound request and the response written by next as an Entry of the Har.
+// Request and response bodies are captured following the same rules as
+// WithRequestBody and WithResponseBody options, up to the limit set by
+// WithRecordBodyLimit.
+//
+// Example:
+//
+//	http.ListenAndServe(":8080", h.Middleware(mux))
+func (h *Handler) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			started  = time.Now()
+			reqBody  *limitedBuffer
+			recorder = &responseRecorder{ResponseWriter: w, h: h, body: limitedBuffer{limit: h.recordLimit}}
+		)
+		if r.Body != nil && r.Body != http.NoBody && h.isReqBody(r) {
+			reqBody = &limitedBuffer{limit: h.recordLimit}
+			r.Body = &teeReadCloser{Reader: io.TeeReader(r.Body, reqBody), Closer: r.Body}
+		}
+
+		next.ServeHTTP(recorder, r)
+
+		if err := h.record(started, r, reqBody, recorder); err != nil {
+			h.log.Error("go-har: record %s %s: %s", r.Method, r.URL, err)
+		}
+	})
+}
+
+// record stores the exchange captured by Middleware as an Entry.
+func (h *Handler) record(started time.Time, r *http.Request, reqBody *limitedBuffer, w *responseRecorder) error {
+	var req = r.Clone(r.Context())
+	if req.URL.Host == "" {
+		req.URL.Host = r.Host
+	}
+	if req.URL.Scheme == "" {
+		req.URL.Scheme = "http"
+		if r.TLS != nil {
+			req.URL.Scheme = "https"
+		}
+	}
+	if reqBody != nil {
+		// the server discards what the handler left unread, keep it for the Har
+		// up to the limit, one more byte tells whether the body is truncated.
+		if reqBody.limit > 0 {
+			_, _ = io.CopyN(reqBody, r.Body, max(0, reqBody.limit-int64(reqBody.Len()))+1)
+		} else {
+			_, _ = io.Copy(reqBody, r.Body)
+		}
+		req.Body = io.NopCloser(&reqBody.buf)
+	}
+
+	var withBody = reqBody != nil && !reqBody.truncated
+	nr, err := NewRequest(req, withBody)
+	if err != nil {
+		return err
+	}
+	if reqBody != nil && reqBody.truncated {
+		// a truncated body cannot be parsed, keep the bytes received
+		nr.BodySize = r.ContentLength
+		if nr.PostData != nil {
+			nr.PostData.Text = reqBody.buf.String()
+			nr.PostData.Comment = fmt.Sprintf("go-har: body truncated to %d bytes", reqBody.Len())
+		}
+	}
+	var entry = h.newEntry(started, nr)
+
+	if !w.wroteHeader && !w.hijacked {
+		// net/http replies 200 when the handler writes nothing
+		w.wroteHeader = true
+		w.status = http.StatusOK
+		w.header = w.ResponseWriter.Header().Clone()
+	}
+	if w.wroteHeader {
+		var res = w.response(r)
+		resp, err := NewResponse(res, w.withBody && !w.body.truncated)
+		if err != nil {
+			return err
+		}
+		if w.withBody && w.body.truncated {
+			resp.Content.Comment = fmt.Sprintf("go-har: body not recorded, %d bytes over the limit of %d bytes", w.size, w.body.limit)
+		}
+		resp.Comment = h.comment
+		// Har has no notion of trailers, list them along with the headers
+		resp.Headers = append(resp.Headers, headers(res.Trailer)...)
+		entry.Response = resp
+	}
+	// only the time spent by the handler is known on the server side
+	var (
+		end       = time.Now()
+		firstByte = orTime(w.wroteAt, end)
+	)
+	entry.Timings = &Timings{
+		Blocked: -1,
+		DNS:     -1,
+		Connect: -1,
+		Ssl:     -1,
+		Wait:    span(started, firstByte),
+		Receive: span(firstByte, end),
+	}
+	entry.Time = entry.Timings.total()
+	// the server is the one that was connected, the client port identifies the connection
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		entry.ServerIPAddress = addrIP(addr)
+	}
+	if _, port, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		entry.Connection = port
+	}
+	var id = h.nextID()
+	if err := h.addEntry(id, entry); err != nil {
+		return err
+	}
+	h.complete(id)
+	return nil
+}
+
+// limitedBuffer is a bytes.Buffer keeping at most limit bytes, 0 indicates
+// no limit. The bytes written over the limit are discarded.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int64
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	var keep = int64(len(p))
+	if b.limit > 0 && int64(b.buf.Len())+keep > b.limit {
+		keep = max(0, b.limit-int64(b.buf.Len()))
+		b.truncated = true
+	}
+	b.buf.Write(p[:keep])
+	return len(p), nil
+}
+
+func (b *limitedBuffer) Len() int {
+	return b.buf.Len()
+}
+
+// teeReadCloser copies everything read from the request body into a buffer.
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// responseRecorder is an http.ResponseWriter that captures the status,
+// headers, trailers and body written by the wrapped handler.
+type responseRecorder struct {
+	http.ResponseWriter
+	h           *Handler
+	status      int
+	header      http.Header
+	body        limitedBuffer
+	size        int64
+	wroteAt     time.Time
+	wroteHeader bool
+	wroteBody   bool
+	withBody    bool
+	hijacked    bool
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *responseRecorder) WriteHeader(code int) {
+	if w.wroteHeader {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	// informational headers may be written several times before the final one
+	if code >= 100 && code <= 199 && code != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.wroteHeader = true
+	w.wroteAt = time.Now()
+	w.status = code
+	w.header = w.ResponseWriter.Header().Clone()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements http.ResponseWriter.
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.wroteBody {
+		w.wroteBody = true
+		// net/http sniffs the Content-Type of the first write when it is not set
+		if _, ok := w.header["Content-Type"]; !ok && w.header.Get("Content-Encoding") == "" {
+			w.header.Set("Content-Type", http.DetectContentType(p))
+		}
+		w.withBody = w.h.isRespBody(&http.Response{StatusCode: w.status, Header: w.header})
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.size += int64(n)
+	if w.withBody {
+		w.body.Write(p[:n])
+	}
+	return n, err
+}
+
+// Flush implements http.Flusher.
+func (w *responseRecorder) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker. Data exchanged over a hijacked
+// connection is not recorded.
+func (w *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("go-har: %T does not implement http.Hijacker", w.ResponseWriter)
+	}
+	w.hijacked = true
+	return hj.Hijack()
+}
+
+// Unwrap returns the original http.ResponseWriter, used by http.ResponseController.
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// response builds the http.Response written by the handler.
+func (w *responseRecorder) response(r *http.Request) *http.Response {
+	var resp = &http.Response{
+		Status:        fmt.Sprintf("%d %s", w.status, http.StatusText(w.status)),
+		StatusCode:    w.status,
+		Proto:         r.Proto,
+		ProtoMajor:    r.ProtoMajor,
+		ProtoMinor:    r.ProtoMinor,
+		Header:        w.header,
+		Body:          io.NopCloser(&w.body.buf),
+		ContentLength: w.size,
+		Request:       r,
+	}
+	if w.hijacked {
+		resp.ContentLength = 0
+	}
+
+	// trailers are either announced by the "Trailer" header or set
+	// afterward using the http.TrailerPrefix.
+	var header = w.ResponseWriter.Header()
+	for _, v := range w.header.Values("Trailer") {
+		for _, k := range strings.Split(v, ",") {
+			k = http.CanonicalHeaderKey(strings.TrimSpace(k))
+			if vs, ok := header[k]; ok {
+				if resp.Trailer == nil {
+					resp.Trailer = make(http.Header)
+				}
+				resp.Trailer[k] = vs
+			}
+		}
+	}
+	for k, vs := range header {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			if resp.Trailer == nil {
+				resp.Trailer = make(http.Header)
+			}
+			resp.Trailer[http.CanonicalHeaderKey(strings.TrimPrefix(k, http.TrailerPrefix))] = vs
+		}
+	}
+	return resp
+}
@@ -0,0 +1,365 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRoundTripper(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write(append([]byte("echo:"), body...))
+	}))
+	defer srv.Close()
+
+	h, err := NewHandler(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: h.RoundTripper(nil)}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Post(srv.URL+"/echo", "text/plain", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatalf("Post: %s", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			t.Fatalf("ReadAll: %s", err)
+		}
+		if string(body) != "echo:hello" {
+			t.Errorf("body: got %q, want %q", body, "echo:hello")
+		}
+	}
+
+	if got := h.EntryTotal(); got != 2 {
+		t.Fatalf("EntryTotal: got %d, want 2", got)
+	}
+	for _, e := range h.Export().Log.Entries {
+		if e.Request.Method != http.MethodPost || e.Request.URL != srv.URL+"/echo" {
+			t.Errorf("request: got %s %s", e.Request.Method, e.Request.URL)
+		}
+		if e.Request.PostData == nil || e.Request.PostData.Text != "hello" {
+			t.Errorf("request post data: got %+v", e.Request.PostData)
+		}
+		if e.Response.Status != http.StatusOK {
+			t.Errorf("response status: got %d, want %d", e.Response.Status, http.StatusOK)
+		}
+		if string(e.Response.Content.Text) != "echo:hello" {
+			t.Errorf("response content: got %q", e.Response.Content.Text)
+		}
+	}
+}
+
+func TestRoundTripperUnrecordable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(append([]byte("echo:"), body...))
+	}))
+	defer srv.Close()
+
+	h, err := NewHandler(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: h.RoundTripper(nil)}
+
+	// the malformed Content-Type cannot be recorded but the request is sent
+	resp, err := client.Post(srv.URL, "text/plain; charset", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("Post: %s", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(body) != "echo:hello" {
+		t.Errorf("body: got %q, want %q", body, "echo:hello")
+	}
+	if got := h.EntryTotal(); got != 0 {
+		t.Errorf("EntryTotal: got %d, want 0", got)
+	}
+}
+
+func TestRoundTripperCompressed(t *testing.T) {
+	var text = strings.Repeat("go-har ", 1000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Type", "text/plain")
+		gw := gzip.NewWriter(w)
+		_, _ = gw.Write([]byte(text))
+		_ = gw.Close()
+	}))
+	defer srv.Close()
+
+	h, err := NewHandler(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: h.RoundTripper(nil)}
+
+	// the transport asks for gzip and decodes the body itself
+	resp, err := client.Get(srv.URL + "/transparent")
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	// the caller asks for gzip and gets the encoded body
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/explicit", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %s", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	entries := h.Export().Log.Entries
+	if res := entries[0].Response; res.BodySize != -1 || res.Content.Compression != 0 || string(res.Content.Text) != text {
+		t.Errorf("decoded by the transport: bodySize %d, compression %d", res.BodySize, res.Content.Compression)
+	}
+	if res := entries[1].Response; res.BodySize <= 0 || res.BodySize >= int64(len(text)) ||
+		res.Content.Compression != int64(len(text))-res.BodySize || string(res.Content.Text) != text {
+		t.Errorf("encoded: bodySize %d, compression %d", res.BodySize, res.Content.Compression)
+	}
+}
+
+func TestRoundTripperStream(t *testing.T) {
+	var release = make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = io.WriteString(w, "data: second\n\n")
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	h, err := NewHandler(nil, WithRecordBodyLimit(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: h.RoundTripper(nil), Timeout: time.Second}
+
+	// the first event is received while the server still holds the response
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	var buf = make([]byte, len("data: first\n\n"))
+	if _, err := io.ReadFull(resp.Body, buf); err != nil {
+		t.Fatalf("ReadFull: %s", err)
+	}
+	if string(buf) != "data: first\n\n" {
+		t.Errorf("event: got %q", buf)
+	}
+	release <- struct{}{}
+	rest, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatalf("ReadAll: %s", err)
+	}
+	if string(rest) != "data: second\n\n" {
+		t.Errorf("event: got %q", rest)
+	}
+
+	// the body is over the limit of 16 bytes
+	var e = h.Export().Log.Entries[0]
+	if e.Response.Status != http.StatusOK || len(e.Response.Content.Text) != 0 || e.Response.Content.Comment == "" {
+		t.Errorf("response: got status %d, content %+v", e.Response.Status, e.Response.Content)
+	}
+	if e.Response.BodySize != 27 {
+		t.Errorf("BodySize: got %d, want 27", e.Response.BodySize)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	h, err := NewHandler(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("got:"))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write(body)
+		w.Header().Set("X-Checksum", "abc")
+	})))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/upload?a=1", "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("Post: %s", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(body) != "got:payload" {
+		t.Errorf("body: got %q, want %q", body, "got:payload")
+	}
+
+	if got := h.EntryTotal(); got != 1 {
+		t.Fatalf("EntryTotal: got %d, want 1", got)
+	}
+	e := h.Export().Log.Entries[0]
+	if e.Request.URL != srv.URL+"/upload?a=1" {
+		t.Errorf("request url: got %s, want %s", e.Request.URL, srv.URL+"/upload?a=1")
+	}
+	if e.Request.PostData == nil || e.Request.PostData.Text != "payload" {
+		t.Errorf("request post data: got %+v", e.Request.PostData)
+	}
+	if e.Response.Status != http.StatusCreated {
+		t.Errorf("response status: got %d, want %d", e.Response.Status, http.StatusCreated)
+	}
+	if string(e.Response.Content.Text) != "got:payload" {
+		t.Errorf("response content: got %q", e.Response.Content.Text)
+	}
+	if e.ServerIPAddress != "127.0.0.1" || e.Connection == "" {
+		t.Errorf("connection: got serverIPAddress %q connection %q", e.ServerIPAddress, e.Connection)
+	}
+	var trailer bool
+	for _, nvp := range e.Response.Headers {
+		if nvp.Name == "X-Checksum" && nvp.Value == "abc" {
+			trailer = true
+		}
+	}
+	if !trailer {
+		t.Errorf("response trailer X-Checksum not recorded: %+v", e.Response.Headers)
+	}
+}
+
+// countingBody counts the bytes read from a request body.
+type countingBody struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (b countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+func TestMiddlewareBodyLimit(t *testing.T) {
+	h, err := NewHandler(nil, WithRecordBodyLimit(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read atomic.Int64
+	handler := h.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/upload" {
+			// rejected without reading the body
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		_, _ = w.Write(bytes.Repeat([]byte("x"), 4096))
+	}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = countingBody{ReadCloser: r.Body, n: &read}
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/upload", "application/octet-stream", bytes.NewReader(make([]byte, 1<<20)))
+	if err != nil {
+		t.Fatalf("Post: %s", err)
+	}
+	_ = resp.Body.Close()
+	if n := read.Load(); n > 64<<10 {
+		t.Errorf("request body read by the recorder: %d bytes", n)
+	}
+
+	resp, err = http.Get(srv.URL + "/download")
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if len(body) != 4096 {
+		t.Errorf("response body: got %d bytes, want 4096", len(body))
+	}
+
+	entries := h.Export().Log.Entries
+	if len(entries) != 2 {
+		t.Fatalf("entries: got %d, want 2", len(entries))
+	}
+	pd := entries[0].Request.PostData
+	if pd == nil || len(pd.Text) != 1024 || pd.Comment == "" || entries[0].Request.BodySize != 1<<20 {
+		t.Errorf("truncated request: %d %q %d", len(pd.Text), pd.Comment, entries[0].Request.BodySize)
+	}
+	res := entries[1].Response
+	if len(res.Content.Text) != 0 || res.Content.Comment == "" || res.BodySize != 4096 {
+		t.Errorf("truncated response: bodySize %d text %d comment %q", res.BodySize, len(res.Content.Text), res.Content.Comment)
+	}
+}
+
+func TestMiddlewareImplicitStatus(t *testing.T) {
+	h, err := NewHandler(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Health", "ok")
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status: got %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	var har = h.Export()
+	if err := har.Validate(true); err != nil {
+		t.Fatalf("Validate: %s", err)
+	}
+	res := har.Log.Entries[0].Response
+	if res.Status != http.StatusOK || res.StatusText != "OK" {
+		t.Errorf("status: got %d %q, want 200", res.Status, res.StatusText)
+	}
+	var found bool
+	for _, nv := range res.Headers {
+		found = found || nv.Name == "X-Health" && nv.Value == "ok"
+	}
+	if !found {
+		t.Errorf("headers: got %+v", res.Headers)
+	}
+}
@@ -0,0 +1,139 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures how replayed requests are sent again after a failure,
+// see WithRetry.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a request is sent, the
+	// request is sent once if it is less than 2.
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry, doubled at each retry
+	// up to MaxBackoff, 100ms and 10s by default. The delay is randomized
+	// between half and all of it to spread retries.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// StatusCodes are the response statuses to retry, e.g. 429, 502, 503 and 504.
+	// A Retry-After header of such responses is respected up to MaxBackoff.
+	StatusCodes []int
+	// NetworkErrors whether requests failing with a transport error, e.g. a
+	// refused connection or the timeout of WithRequestTimeout, are retried.
+	NetworkErrors bool
+}
+
+// StatusError is the error of an attempt whose response status is retried.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("go-har: response status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// attemptError returns the error of the attempt r.
+func (p *RetryPolicy) attemptError(r *Receipt) error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.Response != nil && slices.Contains(p.StatusCodes, r.Response.StatusCode) {
+		return &StatusError{StatusCode: r.Response.StatusCode}
+	}
+	return nil
+}
+
+// retryable reports whether the failed attempt r can be retried.
+func (p *RetryPolicy) retryable(r *Receipt) bool {
+	if r.err == nil {
+		return true
+	}
+	// errors building the request would fail again
+	var ue *url.Error
+	return p.NetworkErrors && errors.As(r.err, &ue)
+}
+
+// backoff returns the delay before the retry following the attempt n.
+func (p *RetryPolicy) backoff(n int, resp *http.Response) time.Duration {
+	var (
+		minBackoff = p.MinBackoff
+		maxBackoff = p.MaxBackoff
+	)
+	if minBackoff <= 0 {
+		minBackoff = 100 * time.Millisecond
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = 10 * time.Second
+	}
+	// doubling stops at maxBackoff, before the shift overflows
+	var d = min(minBackoff, maxBackoff)
+	for i := 1; i < n && d < maxBackoff; i++ {
+		if d >= maxBackoff/2 {
+			d = maxBackoff
+			break
+		}
+		d *= 2
+	}
+	d = d/2 + rand.N(d/2+1)
+	if resp != nil {
+		d = max(d, min(maxBackoff, retryAfter(resp.Header.Get("Retry-After"))))
+	}
+	return d
+}
+
+// retryAfter returns the delay of a Retry-After header, in seconds or an http date.
+func retryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(0, s)) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(0, time.Until(t))
+	}
+	return 0
+}
+
+// sleep waits for d, it returns false if ctx is done before.
+func sleep(ctx context.Context, d time.Duration) bool {
+	var timer = time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,124 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExecuteRetry(t *testing.T) {
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	// the server is closed at once to fail with a network error
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	var (
+		har    = newReplayHar(srv.URL, []string{"/"}, []time.Duration{0})
+		policy = RetryPolicy{
+			MaxAttempts:   3,
+			MinBackoff:    time.Millisecond,
+			MaxBackoff:    5 * time.Millisecond,
+			StatusCodes:   []int{http.StatusServiceUnavailable},
+			NetworkErrors: true,
+		}
+	)
+	har.Log.Entries = append(har.Log.Entries, newReplayHar(closed.URL, []string{"/"}, []time.Duration{0}).Log.Entries...)
+	h, err := NewHandler(har, WithRetry(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipts, err := h.Execute(context.TODO())
+	if err != nil {
+		t.Fatalf("Execute: %s", err)
+	}
+
+	r := receipts[0]
+	if r.Error() != nil || r.Response.StatusCode != http.StatusOK {
+		t.Fatalf("retried: %v %v", r.Error(), r.Response)
+	}
+	errs := r.AttemptErrors()
+	var se *StatusError
+	if r.Attempts() != 3 || !errors.As(errs[0], &se) || se.StatusCode != http.StatusServiceUnavailable || errs[2] != nil {
+		t.Errorf("retried attempts: %d %v", r.Attempts(), errs)
+	}
+
+	r = receipts[1]
+	if r.Error() == nil || r.Attempts() != 3 {
+		t.Errorf("network error: got %v after %d attempts", r.Error(), r.Attempts())
+	}
+
+	calls.Store(0)
+	h, err = NewHandler(har, WithRetry(RetryPolicy{MaxAttempts: 3, StatusCodes: []int{http.StatusServiceUnavailable}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipts, err = h.Execute(context.TODO())
+	if err != nil {
+		t.Fatalf("Execute: %s", err)
+	}
+	if r := receipts[1]; r.Attempts() != 1 {
+		t.Errorf("network error not retried: got %d attempts", r.Attempts())
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for n, want := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		if d := p.backoff(n, nil); d < want/2 || d > want {
+			t.Errorf("attempt %d: backoff %s, want in [%s, %s]", n, d, want/2, want)
+		}
+	}
+	// the delay does not overflow with many attempts
+	big := RetryPolicy{MinBackoff: 5 * time.Second, MaxBackoff: time.Minute}
+	for _, n := range []int{35, 40, 100} {
+		if d := big.backoff(n, nil); d < 30*time.Second || d > time.Minute {
+			t.Errorf("attempt %d: backoff %s, want in [30s, 1m]", n, d)
+		}
+	}
+
+	p.MaxBackoff = 3 * time.Second
+	resp := &http.Response{Header: http.Header{"Retry-After": {"3"}}}
+	if d := p.backoff(1, resp); d != 3*time.Second {
+		t.Errorf("Retry-After: got %s, want 3s", d)
+	}
+	// Retry-After is capped by MaxBackoff
+	resp.Header.Set("Retry-After", "86400")
+	if d := p.backoff(1, resp); d != 3*time.Second {
+		t.Errorf("Retry-After: got %s, want 3s", d)
+	}
+}
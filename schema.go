@@ -39,10 +39,6 @@ type Har struct {
 	Log *Log `json:"log"`
 }
 
-func (h *Har) Validate() error {
-	return nil
-}
-
 // Log This object represents the root of the exported data.
 // This object MUST be present and its name MUST be "log".
 // The object contains the following name/value pairs:
@@ -127,6 +123,9 @@ type PageTimings struct {
 // the preferred way how to export data since it can make importing faster.
 // However, the reader application should always make sure the array is sorted (if required for the import)
 type Entry struct {
+	// [custom] Unique identifier of the entry within the Har, assigned by
+	// go-har when absent. It is used to look up the entry, see Handler.Entry.
+	ID string `json:"_id,omitempty"`
 	// [string, unique, optional] Reference to the parent page.
 	// Leave out this field if the application does not support grouping by pages.
 	PageRef string `json:"pageref,omitempty"`
@@ -355,8 +354,9 @@ type Content struct {
 // For marshaling Content to and from json. This works around the json library's
 // default conversion of []byte to base64 encoded string.
 type contentJSON struct {
-	Size     int64  `json:"size"`
-	MimeType string `json:"mimeType"`
+	Size        int64  `json:"size"`
+	Compression int64  `json:"compression,omitempty"`
+	MimeType    string `json:"mimeType"`
 
 	// Text contains the response body sent from the server or loaded from the
 	// browser cache. This field is populated with textual content only. The text
@@ -369,6 +369,8 @@ type contentJSON struct {
 	// if the text field is HTTP decoded (decompressed & unchunked), than
 	// trans-coded from its original character set into UTF-8.
 	Encoding string `json:"encoding,omitempty"`
+
+	Comment string `json:"comment,omitempty"`
 }
 
 // MarshalJSON marshals the byte slice into json after encoding based on c.Encoding.
@@ -384,10 +386,12 @@ func (c *Content) MarshalJSON() ([]byte, error) {
 	}
 
 	cj := contentJSON{
-		Size:     c.Size,
-		MimeType: c.MimeType,
-		Text:     txt,
-		Encoding: c.Encoding,
+		Size:        c.Size,
+		Compression: c.Compression,
+		MimeType:    c.MimeType,
+		Text:        txt,
+		Encoding:    c.Encoding,
+		Comment:     c.Comment,
 	}
 	return json.Marshal(cj)
 }
@@ -416,9 +420,11 @@ func (c *Content) UnmarshalJSON(data []byte) error {
 	}
 
 	c.Size = cj.Size
+	c.Compression = cj.Compression
 	c.MimeType = cj.MimeType
 	c.Text = txt
 	c.Encoding = cj.Encoding
+	c.Comment = cj.Comment
 	return nil
 }
 
@@ -0,0 +1,365 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+	"sync"
+)
+
+// StreamReader reads a Har document token by token, decoding one Entry at a
+// time so that documents larger than the available memory can be processed.
+type StreamReader struct {
+	dec  *json.Decoder
+	log  *Log
+	read bool
+}
+
+// NewStreamReader returns a StreamReader reading the Har document from r.
+func NewStreamReader(r io.Reader) *StreamReader {
+	return &StreamReader{
+		dec: json.NewDecoder(r),
+		log: &Log{},
+	}
+}
+
+// Log returns the metadata of the log without its entries. Only the fields
+// located before the entries in the document are available until the
+// entries have been entirely read, browsers write them first though.
+func (s *StreamReader) Log() *Log {
+	return s.log
+}
+
+// Pages returns the pages of the log, see Log for their availability.
+func (s *StreamReader) Pages() []*Page {
+	return s.log.Pages
+}
+
+// Entries returns an iterator over the entries of the document. The
+// document can be read only once, breaking out of the loop stops reading.
+//
+// Example:
+//
+//	for e, err := range s.Entries() {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(e.Request.URL)
+//	}
+func (s *StreamReader) Entries() iter.Seq2[*Entry, error] {
+	return func(yield func(*Entry, error) bool) {
+		var stopped bool
+		err := s.walk(func(e *Entry) bool {
+			stopped = !yield(e, nil)
+			return !stopped
+		})
+		if err != nil && !stopped {
+			yield(nil, err)
+		}
+	}
+}
+
+// Walk calls fn for each entry of the document until fn returns an error,
+// which is then returned by Walk.
+func (s *StreamReader) Walk(fn func(e *Entry) error) error {
+	var ferr error
+	err := s.walk(func(e *Entry) bool {
+		ferr = fn(e)
+		return ferr == nil
+	})
+	if ferr != nil {
+		return ferr
+	}
+	return err
+}
+
+// walk reads the document and calls fn for each entry, stops when fn returns false.
+func (s *StreamReader) walk(fn func(e *Entry) bool) error {
+	if s.read {
+		return errors.New("go-har: stream already read")
+	}
+	s.read = true
+
+	if err := s.delim('{'); err != nil {
+		return err
+	}
+	for s.dec.More() {
+		key, err := s.key()
+		if err != nil {
+			return err
+		}
+		if key != "log" {
+			if err := s.skip(); err != nil {
+				return err
+			}
+			continue
+		}
+		next, err := s.readLog(fn)
+		if err != nil || !next {
+			return err
+		}
+	}
+	return s.delim('}')
+}
+
+// readLog reads the log object, returns false if fn stopped the reading.
+func (s *StreamReader) readLog(fn func(e *Entry) bool) (bool, error) {
+	if err := s.delim('{'); err != nil {
+		return false, err
+	}
+	for s.dec.More() {
+		key, err := s.key()
+		if err != nil {
+			return false, err
+		}
+		switch key {
+		case "version":
+			err = s.decode(key, &s.log.Version)
+		case "creator":
+			err = s.decode(key, &s.log.Creator)
+		case "browser":
+			err = s.decode(key, &s.log.Browser)
+		case "pages":
+			err = s.decode(key, &s.log.Pages)
+		case "comment":
+			err = s.decode(key, &s.log.Comment)
+		case "entries":
+			if err := s.delim('['); err != nil {
+				return false, err
+			}
+			for s.dec.More() {
+				var e Entry
+				if err := s.decode(key, &e); err != nil {
+					return false, err
+				}
+				if !fn(&e) {
+					return false, nil
+				}
+			}
+			err = s.delim(']')
+		default:
+			err = s.skip()
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, s.delim('}')
+}
+
+func (s *StreamReader) decode(key string, v any) error {
+	if err := s.dec.Decode(v); err != nil {
+		return fmt.Errorf("decode %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *StreamReader) key() (string, error) {
+	tok, err := s.dec.Token()
+	if err != nil {
+		return "", fmt.Errorf("decode: %w", err)
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("decode: unexpected token %v at offset %d", tok, s.dec.InputOffset())
+	}
+	return key, nil
+}
+
+func (s *StreamReader) delim(want json.Delim) error {
+	tok, err := s.dec.Token()
+	if err != nil {
+		return fmt.Errorf("decode: %w", err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("decode: expected %q, got %v at offset %d", want, tok, s.dec.InputOffset())
+	}
+	return nil
+}
+
+// skip discards the next value of the document.
+func (s *StreamReader) skip() error {
+	var raw json.RawMessage
+	return s.decode("value", &raw)
+}
+
+// StreamWriter writes a Har document incrementally, each Entry is written as
+// soon as it is given so that memory stays flat. If the capture is interrupted
+// before Close, the entries already written can still be recovered with a
+// StreamReader.
+type StreamWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	n      int
+	pages  []*Page
+	err    error
+	closed bool
+}
+
+// NewStreamWriter writes the header of the log to w and returns a StreamWriter
+// appending entries to it. The entries and pages of log are ignored,
+// use WriteEntry and WritePage instead. A nil log writes a go-har log.
+func NewStreamWriter(w io.Writer, log *Log) (*StreamWriter, error) {
+	if log == nil {
+		log = &Log{Version: "1.2", Creator: &Creator{Name: "go-har", Version: "0.0.1"}}
+	}
+	header, err := json.Marshal(struct {
+		Version string   `json:"version"`
+		Creator *Creator `json:"creator"`
+		Browser *Browser `json:"browser,omitempty"`
+		Comment string   `json:"comment,omitempty"`
+	}{
+		Version: log.Version,
+		Creator: log.Creator,
+		Browser: log.Browser,
+		Comment: log.Comment,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encode log: %w", err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"log":`)
+	buf.Write(header[:len(header)-1])
+	buf.WriteString(`,"entries":[`)
+	var sw = &StreamWriter{w: w}
+	if err := sw.write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+// WriteEntry appends e to the entries of the document.
+func (s *StreamWriter) WriteEntry(e *Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encode entry: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("go-har: stream writer is closed")
+	}
+	if s.n > 0 {
+		data = append([]byte(",\n"), data...)
+	} else {
+		data = append([]byte("\n"), data...)
+	}
+	if err := s.write(data); err != nil {
+		return err
+	}
+	s.n++
+	return nil
+}
+
+// WritePage adds p to the pages of the document. Pages are written
+// after the entries when the StreamWriter is closed.
+func (s *StreamWriter) WritePage(p *Page) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("go-har: stream writer is closed")
+	}
+	if i := slices.IndexFunc(s.pages, func(v *Page) bool { return v.ID == p.ID }); i >= 0 {
+		s.pages[i] = p
+	} else {
+		s.pages = append(s.pages, p)
+	}
+	return nil
+}
+
+// Close terminates the entries array, writes the pages and ends the document.
+// It does not close the underlying writer.
+func (s *StreamWriter) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return s.err
+	}
+	s.closed = true
+
+	var buf bytes.Buffer
+	buf.WriteString("\n]")
+	if len(s.pages) > 0 {
+		pages, err := json.Marshal(s.pages)
+		if err != nil {
+			return fmt.Errorf("encode pages: %w", err)
+		}
+		buf.WriteString(`,"pages":`)
+		buf.Write(pages)
+	}
+	buf.WriteString("}}\n")
+	return s.write(buf.Bytes())
+}
+
+// write writes data and flushes the underlying writer if it is buffered,
+// the first error is sticky.
+func (s *StreamWriter) write(data []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	if _, err := s.w.Write(data); err != nil {
+		s.err = fmt.Errorf("go-har: stream write: %w", err)
+		return s.err
+	}
+	if f, ok := s.w.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			s.err = fmt.Errorf("go-har: stream flush: %w", err)
+			return s.err
+		}
+	}
+	return nil
+}
+
+// complete hands the entry identified by id over to the StreamWriter if one
+// is configured, the entry is then no longer kept in memory.
+func (h *Handler) complete(id string) {
+	if h.stream == nil {
+		return
+	}
+
+	h.mu.Lock()
+	e, ok := h.entries[id]
+	if ok {
+		delete(h.entries, id)
+		h.har.Log.Entries = slices.DeleteFunc(h.har.Log.Entries, func(v *Entry) bool {
+			return v == e
+		})
+	}
+	h.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	if err := h.stream.WriteEntry(e); err != nil {
+		h.log.Error("go-har: stream entry %s: %s", id, err)
+	}
+}
@@ -0,0 +1,164 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStreamReader(t *testing.T) {
+	file, err := os.Open("./testdata/zh.wikipedia.org.har")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	s := NewStreamReader(file)
+	var urls []string
+	for e, err := range s.Entries() {
+		if err != nil {
+			t.Fatalf("Entries: %s", err)
+		}
+		urls = append(urls, e.Request.URL)
+	}
+	if len(urls) != 3 || urls[0] != "https://zh.wikipedia.org/wiki/.har" {
+		t.Errorf("entries: got %v", urls)
+	}
+	if l := s.Log(); l.Version != "1.2" || l.Creator == nil || l.Creator.Name != "WebInspector" {
+		t.Errorf("log: got %+v", l)
+	}
+	if len(s.Pages()) != 1 || s.Pages()[0].ID != "page_1" {
+		t.Errorf("pages: got %+v", s.Pages())
+	}
+	if err := s.Walk(func(*Entry) error { return nil }); err == nil {
+		t.Error("Walk: want stream already read error")
+	}
+}
+
+func TestStreamReaderStop(t *testing.T) {
+	const data = `{"log": {"version": "1.2", "_custom": [1, {"a": 2}], "entries": [
+		{"request": {"method": "GET", "url": "https://example.com/1"}},
+		{"request": {"method": "GET", "url": "https://example.com/2"}},
+		{"request": {"method": "GET", "url": "https://example.com/3"}}
+	], "comment": "done"}}`
+
+	var (
+		stop = errors.New("stop")
+		n    int
+	)
+	err := NewStreamReader(strings.NewReader(data)).Walk(func(e *Entry) error {
+		if n++; n == 2 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || n != 2 {
+		t.Errorf("Walk: got %v after %d entries, want stop after 2", err, n)
+	}
+
+	s := NewStreamReader(strings.NewReader(data))
+	for range s.Entries() {
+	}
+	if s.Log().Comment != "done" {
+		t.Errorf("comment: got %q, want done", s.Log().Comment)
+	}
+
+	var got error
+	for _, err := range NewStreamReader(strings.NewReader(`{"log": {"entries": [{"request": 1}]}}`)).Entries() {
+		got = err
+	}
+	if got == nil {
+		t.Error("Entries: want decode error")
+	}
+}
+
+func TestStreamWriter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	sw, err := NewStreamWriter(&buf, nil)
+	if err != nil {
+		t.Fatalf("NewStreamWriter: %s", err)
+	}
+	h, err := NewHandler(nil, WithStreamWriter(sw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.StartPage("page_1", "stream"); err != nil {
+		t.Fatalf("StartPage: %s", err)
+	}
+	client := &http.Client{Transport: h.RoundTripper(nil)}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get: %s", err)
+		}
+		_ = resp.Body.Close()
+	}
+	if got := h.EntryTotal(); got != 0 {
+		t.Errorf("EntryTotal: got %d, want entries streamed out of memory", got)
+	}
+
+	// an interrupted capture still yields the entries written so far
+	var n int
+	for _, err := range NewStreamReader(bytes.NewReader(buf.Bytes())).Entries() {
+		if err != nil {
+			break
+		}
+		n++
+	}
+	if n != 2 {
+		t.Errorf("interrupted stream: got %d entries, want 2", n)
+	}
+
+	if err := h.FinishPage("page_1", nil); err != nil {
+		t.Fatalf("FinishPage: %s", err)
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+	if err := sw.WriteEntry(&Entry{}); err == nil {
+		t.Error("WriteEntry: want closed error")
+	}
+
+	r, err := NewReader(&buf, WithStrictValidation(true))
+	if err != nil {
+		t.Fatalf("NewReader: %s", err)
+	}
+	if got := r.EntryTotal(); got != 2 {
+		t.Errorf("EntryTotal: got %d, want 2", got)
+	}
+	if got := len(r.PageEntries("page_1")); got != 2 {
+		t.Errorf("PageEntries: got %d, want 2", got)
+	}
+}
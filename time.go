@@ -25,6 +25,7 @@ package go_har
 
 import (
 	"errors"
+	"strings"
 	"time"
 )
 
@@ -56,16 +57,18 @@ func (t *Time) String() string {
 	return time.Time(*t).String()
 }
 
-// ParseISO8601 parse ISO8601 standard format time
+// ParseISO8601 parse ISO8601 standard format time, the value may be quoted as
+// found in JSON documents.
 func ParseISO8601(str string) (time.Time, error) {
+	str = strings.Trim(str, `"`)
 	if str == "" {
 		return time.Time{}, errors.New("time value is empty")
 	}
-	t, err := time.ParseInLocation(`"`+time.RFC3339+`"`, str, time.Local)
+	t, err := time.ParseInLocation(time.RFC3339, str, time.Local)
 	if err != nil {
-		t, err = time.ParseInLocation(`"`+time.RFC3339Nano+`"`, str, time.Local)
+		t, err = time.ParseInLocation(time.RFC3339Nano, str, time.Local)
 		if err != nil {
-			t, err = time.ParseInLocation(`"`+iso8601ext+`"`, str, time.Local)
+			t, err = time.ParseInLocation(iso8601ext, str, time.Local)
 			if err != nil {
 				return time.Time{}, err
 			}
@@ -73,3 +76,8 @@ func ParseISO8601(str string) (time.Time, error) {
 	}
 	return t, nil
 }
+
+// millis converts d to the fractional milliseconds used by Har timings.
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,212 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// tracer measures the phases of an http round trip through httptrace.ClientTrace.
+type tracer struct {
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	end          time.Time
+	reused       bool
+	remoteAddr   net.Addr
+	localAddr    net.Addr
+}
+
+func newTracer() *tracer {
+	return &tracer{start: time.Now()}
+}
+
+// clientTrace returns the hooks to be installed in the request context.
+func (t *tracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.set(&t.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.set(&t.dnsDone)
+		},
+		ConnectStart: func(string, string) {
+			t.set(&t.connectStart)
+		},
+		ConnectDone: func(string, string, error) {
+			t.set(&t.connectDone)
+		},
+		TLSHandshakeStart: func() {
+			t.set(&t.tlsStart)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.set(&t.tlsDone)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.gotConn = time.Now()
+			t.reused = info.Reused
+			if info.Conn != nil {
+				t.remoteAddr = info.Conn.RemoteAddr()
+				t.localAddr = info.Conn.LocalAddr()
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.set(&t.wroteRequest)
+		},
+		GotFirstResponseByte: func() {
+			t.set(&t.firstByte)
+		},
+	}
+}
+
+func (t *tracer) set(field *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*field = time.Now()
+}
+
+// finish marks the response body as entirely received.
+func (t *tracer) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.end.IsZero() {
+		t.end = time.Now()
+	}
+}
+
+// timings returns the Har timings of the traced round trip. Phases that did
+// not apply, e.g. dns, connect and ssl for a reused connection, are set to -1.
+func (t *tracer) timings() *Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var (
+		tm        = &Timings{Blocked: -1, DNS: -1, Connect: -1, Ssl: -1}
+		gotConn   = orTime(t.gotConn, t.start)
+		wrote     = orTime(t.wroteRequest, gotConn)
+		firstByte = orTime(t.firstByte, wrote)
+		end       = orTime(t.end, firstByte)
+	)
+
+	var dial = gotConn
+	if !t.reused {
+		if !t.connectStart.IsZero() && t.connectStart.Before(dial) {
+			dial = t.connectStart
+		}
+		if !t.dnsStart.IsZero() && t.dnsStart.Before(dial) {
+			dial = t.dnsStart
+			tm.DNS = span(t.dnsStart, t.dnsDone)
+		}
+		if !t.connectStart.IsZero() {
+			// ssl is also included in the connect field as required by Har 1.2
+			tm.Connect = span(t.connectStart, orTime(t.tlsDone, t.connectDone))
+		}
+		if !t.tlsStart.IsZero() {
+			tm.Ssl = span(t.tlsStart, t.tlsDone)
+		}
+	}
+	tm.Blocked = span(t.start, dial)
+	tm.Send = span(gotConn, wrote)
+	tm.Wait = span(wrote, firstByte)
+	tm.Receive = span(firstByte, end)
+	return tm
+}
+
+// apply fills in the timings and the connection info of the traced round trip into e.
+func (t *tracer) apply(e *Entry) {
+	var timings = t.timings()
+	e.Timings = timings
+	e.Time = timings.total()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e.ServerIPAddress = addrIP(t.remoteAddr)
+	e.Connection = addrPort(t.localAddr)
+}
+
+// total returns the total elapsed time of the timings, which is the sum of all
+// applicable phases. ssl is not summed since it is already part of connect.
+func (t *Timings) total() float64 {
+	var sum float64
+	for _, v := range []float64{t.Blocked, t.DNS, t.Connect, t.Send, t.Wait, t.Receive} {
+		if v > 0 {
+			sum += v
+		}
+	}
+	return sum
+}
+
+// span returns the milliseconds elapsed between from and to, never negative.
+func span(from, to time.Time) float64 {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return 0
+	}
+	return millis(to.Sub(from))
+}
+
+func orTime(t, fallback time.Time) time.Time {
+	if t.IsZero() {
+		return fallback
+	}
+	return t
+}
+
+// addrIP returns the ip address of addr without its port.
+func addrIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// addrPort returns the port of addr, Har suggests the client port
+// as the unique id of the TCP/IP connection.
+func addrPort(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return ""
+	}
+	return port
+}
@@ -0,0 +1,136 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func checkTimings(t *testing.T, e *Entry, reused bool) {
+	t.Helper()
+	tm := e.Timings
+	if tm == nil {
+		t.Fatal("timings is nil")
+	}
+	if tm.DNS != -1 {
+		t.Errorf("dns: got %v, want -1 for an ip address", tm.DNS)
+	}
+	if tm.Ssl != -1 {
+		t.Errorf("ssl: got %v, want -1 for plain http", tm.Ssl)
+	}
+	if reused && tm.Connect != -1 {
+		t.Errorf("connect: got %v, want -1 for a reused connection", tm.Connect)
+	}
+	if !reused && tm.Connect < 0 {
+		t.Errorf("connect: got %v, want >= 0 for a new connection", tm.Connect)
+	}
+	if tm.Blocked < 0 || tm.Send < 0 || tm.Wait < 0 || tm.Receive < 0 {
+		t.Errorf("timings: got %+v", tm)
+	}
+	if math.Abs(e.Time-tm.total()) > 1e-9 {
+		t.Errorf("time: got %v, want %v", e.Time, tm.total())
+	}
+}
+
+func TestRoundTripperTimings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	h, err := NewHandler(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: h.RoundTripper(&http.Transport{})}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get: %s", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	entries := h.Export().Log.Entries
+	if len(entries) != 2 {
+		t.Fatalf("entries: got %d, want 2", len(entries))
+	}
+	checkTimings(t, entries[0], false)
+	checkTimings(t, entries[1], true)
+
+	for _, e := range entries {
+		if e.ServerIPAddress != "127.0.0.1" {
+			t.Errorf("serverIPAddress: got %q, want 127.0.0.1", e.ServerIPAddress)
+		}
+	}
+	if entries[0].Connection == "" || entries[0].Connection != entries[1].Connection {
+		t.Errorf("connection: got %q and %q, want the same reused connection",
+			entries[0].Connection, entries[1].Connection)
+	}
+}
+
+func TestExecuteTimings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	h, err := NewHandler(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AddRequest("1", req); err != nil {
+		t.Fatal(err)
+	}
+
+	receipts, err := h.Execute(context.TODO(), WithRequestUrlIs(srv.URL))
+	if err != nil {
+		t.Fatalf("Execute: %s", err)
+	}
+	if len(receipts) != 1 {
+		t.Fatalf("receipts: got %d, want 1", len(receipts))
+	}
+	r := receipts[0]
+	if r.Error() != nil {
+		t.Fatalf("execute: %s", r.Error())
+	}
+	_ = r.Response.Body.Close()
+	if err := r.FillInResponse(); err != nil {
+		t.Fatalf("FillInResponse: %s", err)
+	}
+	checkTimings(t, r.Entry, false)
+	if r.Entry.ServerIPAddress != "127.0.0.1" || r.Entry.Connection == "" {
+		t.Errorf("connection: got serverIPAddress %q connection %q", r.Entry.ServerIPAddress, r.Entry.Connection)
+	}
+}
@@ -0,0 +1,219 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+)
+
+// ValidationError describes a single violation of the Har 1.2 specification.
+type ValidationError struct {
+	// Path is the JSON path of the offending field, e.g. log.entries[3].request.url
+	Path string
+	// Message describes the violation.
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors is the list of violations reported by Har.Validate.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	var msg = make([]string, 0, len(e))
+	for _, v := range e {
+		msg = append(msg, v.Error())
+	}
+	return fmt.Sprintf("go-har: invalid har: %s", strings.Join(msg, "; "))
+}
+
+// Unwrap returns the violations as errors, so that errors.As can
+// be used to inspect them.
+func (e ValidationErrors) Unwrap() []error {
+	var errs = make([]error, 0, len(e))
+	for _, v := range e {
+		errs = append(errs, v)
+	}
+	return errs
+}
+
+// validator collects the violations found while walking a Har.
+type validator struct {
+	strict bool
+	errs   ValidationErrors
+}
+
+func (v *validator) add(path, format string, args ...any) {
+	v.errs = append(v.errs, &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks the Har against the Har 1.2 specification and returns
+// ValidationErrors listing every violation, or nil if the Har is valid.
+//
+// By default, the validation is lenient and only reports what makes the Har
+// unusable, such as missing entries or requests without method or url.
+// Passing strict as true additionally checks the other required fields,
+// startedDateTime formats, page references and that entry time is
+// consistent with its timings.
+func (h *Har) Validate(strict ...bool) error {
+	var v = validator{strict: len(strict) > 0 && strict[0]}
+	v.har(h)
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+func (v *validator) har(h *Har) {
+	if h == nil || h.Log == nil {
+		v.add("log", "is required")
+		return
+	}
+	var l = h.Log
+	if v.strict {
+		if l.Version == "" {
+			v.add("log.version", "is required")
+		}
+		if l.Creator == nil {
+			v.add("log.creator", "is required")
+		} else {
+			if l.Creator.Name == "" {
+				v.add("log.creator.name", "is required")
+			}
+			if l.Creator.Version == "" {
+				v.add("log.creator.version", "is required")
+			}
+		}
+	}
+
+	var pages = make(map[string]struct{}, len(l.Pages))
+	for i, p := range l.Pages {
+		var path = fmt.Sprintf("log.pages[%d]", i)
+		if p == nil {
+			v.add(path, "is null")
+			continue
+		}
+		if !v.strict {
+			pages[p.ID] = struct{}{}
+			continue
+		}
+		if p.ID == "" {
+			v.add(path+".id", "is required")
+		} else if _, ok := pages[p.ID]; ok {
+			v.add(path+".id", "duplicate page id %q", p.ID)
+		}
+		pages[p.ID] = struct{}{}
+		v.dateTime(path+".startedDateTime", p.StartedDateTime)
+		if p.PageTimings == nil {
+			v.add(path+".pageTimings", "is required")
+		}
+	}
+
+	if l.Entries == nil {
+		v.add("log.entries", "is required")
+		return
+	}
+	for i, e := range l.Entries {
+		v.entry(fmt.Sprintf("log.entries[%d]", i), e, pages)
+	}
+}
+
+func (v *validator) entry(path string, e *Entry, pages map[string]struct{}) {
+	if e == nil {
+		v.add(path, "is null")
+		return
+	}
+
+	if e.Request == nil {
+		v.add(path+".request", "is required")
+	} else {
+		if e.Request.Method == "" {
+			v.add(path+".request.method", "is required")
+		}
+		if e.Request.URL == "" {
+			v.add(path+".request.url", "is required")
+		} else if u, err := url.Parse(e.Request.URL); err != nil {
+			v.add(path+".request.url", "%s", err)
+		} else if !u.IsAbs() {
+			v.add(path+".request.url", "%q is not an absolute url", e.Request.URL)
+		}
+	}
+
+	if !v.strict {
+		return
+	}
+
+	if e.PageRef != "" {
+		if _, ok := pages[e.PageRef]; !ok {
+			v.add(path+".pageref", "page %q does not exist", e.PageRef)
+		}
+	}
+	v.dateTime(path+".startedDateTime", e.StartedDateTime)
+
+	if e.Response == nil {
+		v.add(path+".response", "is required")
+	} else if e.Response.Status == 0 {
+		v.add(path+".response.status", "is required")
+	}
+	if e.Cache == nil {
+		v.add(path+".cache", "is required")
+	}
+
+	if e.Timings == nil {
+		v.add(path+".timings", "is required")
+		return
+	}
+	for _, t := range []struct {
+		name  string
+		value float64
+	}{
+		{"send", e.Timings.Send},
+		{"wait", e.Timings.Wait},
+		{"receive", e.Timings.Receive},
+	} {
+		if t.value < 0 {
+			v.add(path+".timings."+t.name, "must not be negative, got %v", t.value)
+		}
+	}
+	// timings are commonly rounded by browsers, tolerate one millisecond
+	if total := e.Timings.total(); math.Abs(e.Time-total) > 1 {
+		v.add(path+".time", "%v is not the sum of its timings %v", e.Time, total)
+	}
+}
+
+// dateTime checks that value is an ISO 8601 date and time.
+func (v *validator) dateTime(path, value string) {
+	if value == "" {
+		v.add(path, "is required")
+		return
+	}
+	if _, err := ParseISO8601(value); err != nil {
+		v.add(path, "%q is not an ISO 8601 date", value)
+	}
+}
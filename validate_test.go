@@ -0,0 +1,113 @@
+// MIT License
+//
+// Copyright (c) 2024 chaunsin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package go_har
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	h, err := Parse("./testdata/zh.wikipedia.org.har", WithStrictValidation(true))
+	if err != nil {
+		t.Fatalf("Parse: %s", err)
+	}
+	if err := h.Export().Validate(true); err != nil {
+		t.Errorf("Validate: %s", err)
+	}
+
+	const data = `{"log": {"version": "1.2", "creator": {"name": "test"}, "entries": [
+		{"pageref": "page_2", "startedDateTime": "yesterday", "time": 10,
+		 "request": {"method": "GET", "url": "/relative"},
+		 "response": {"status": 200}, "cache": {},
+		 "timings": {"send": 1, "wait": -1, "receive": 1}},
+		{"startedDateTime": "2024-01-11T13:21:05.964Z", "time": 0,
+		 "request": {"url": "https://example.com"}}
+	]}}`
+
+	_, err = NewReader(strings.NewReader(data))
+	var lenient ValidationErrors
+	if !errors.As(err, &lenient) {
+		t.Fatalf("NewReader: got %v, want ValidationErrors", err)
+	}
+	checkViolations(t, lenient, []string{
+		"log.entries[0].request.url",
+		"log.entries[1].request.method",
+	})
+
+	_, err = NewReader(strings.NewReader(data), WithStrictValidation(true))
+	var strict ValidationErrors
+	if !errors.As(err, &strict) {
+		t.Fatalf("NewReader: got %v, want ValidationErrors", err)
+	}
+	checkViolations(t, strict, []string{
+		"log.creator.version",
+		"log.entries[0].request.url",
+		"log.entries[0].pageref",
+		"log.entries[0].startedDateTime",
+		"log.entries[0].timings.wait",
+		"log.entries[0].time",
+		"log.entries[1].request.method",
+		"log.entries[1].response",
+		"log.entries[1].cache",
+		"log.entries[1].timings",
+	})
+}
+
+func TestNewHandlerBuiltHar(t *testing.T) {
+	for _, har := range []*Har{{}, {Log: &Log{Version: "1.2"}}} {
+		h, err := NewHandler(har)
+		if err != nil {
+			t.Fatalf("NewHandler: %s", err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+		if err := h.AddRequest("1", req); err != nil {
+			t.Errorf("AddRequest: %s", err)
+		}
+		if got := h.EntryTotal(); got != 1 {
+			t.Errorf("EntryTotal: got %d, want 1", got)
+		}
+	}
+
+	// the Har itself is still reported incomplete
+	var violations ValidationErrors
+	if err := (&Har{Log: &Log{Version: "1.2"}}).Validate(false); !errors.As(err, &violations) {
+		t.Fatalf("Validate: got %v, want ValidationErrors", err)
+	}
+	checkViolations(t, violations, []string{"log.entries"})
+}
+
+func checkViolations(t *testing.T, errs ValidationErrors, paths []string) {
+	t.Helper()
+	var got = make([]string, 0, len(errs))
+	for _, e := range errs {
+		got = append(got, e.Path)
+	}
+	if strings.Join(got, ",") != strings.Join(paths, ",") {
+		t.Errorf("violations: got %v, want %v", got, paths)
+	}
+}